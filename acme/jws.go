@@ -0,0 +1,232 @@
+package acme
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+
+	errgo "gopkg.in/errgo.v1"
+)
+
+// jws is a JWS in the flattened JSON serialization, as used by ACME.
+type jws struct {
+	Protected string `json:"protected"`
+	Payload   string `json:"payload"`
+	Signature string `json:"signature"`
+}
+
+type jwsHeader struct {
+	Alg   string          `json:"alg"`
+	Nonce string          `json:"nonce"`
+	URL   string          `json:"url"`
+	JWK   json.RawMessage `json:"jwk"`
+	KID   string          `json:"kid"`
+}
+
+// jwk holds the members of a JSON web key that are used by the
+// supported key types.
+type jwk struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+var b64 = base64.RawURLEncoding
+
+// errUnsupportedAlgorithm is the cause of errors from verify when the
+// JWS algorithm cannot be used with the key.
+var errUnsupportedAlgorithm = errgo.New("unsupported JWS algorithm")
+
+// parseJWS parses the given JWS, returning the decoded protected
+// header and payload. The signature is not checked.
+func parseJWS(data []byte) (*jws, *jwsHeader, []byte, error) {
+	var j jws
+	if err := json.Unmarshal(data, &j); err != nil {
+		return nil, nil, nil, errgo.Notef(err, "invalid JWS")
+	}
+	hdata, err := b64.DecodeString(j.Protected)
+	if err != nil {
+		return nil, nil, nil, errgo.Notef(err, "invalid JWS protected header")
+	}
+	var h jwsHeader
+	if err := json.Unmarshal(hdata, &h); err != nil {
+		return nil, nil, nil, errgo.Notef(err, "invalid JWS protected header")
+	}
+	payload, err := b64.DecodeString(j.Payload)
+	if err != nil {
+		return nil, nil, nil, errgo.Notef(err, "invalid JWS payload")
+	}
+	return &j, &h, payload, nil
+}
+
+// verify checks the signature on j with the given key. If the
+// algorithm cannot be used with the key the error has a cause of
+// errUnsupportedAlgorithm.
+func (j *jws) verify(alg string, key crypto.PublicKey) error {
+	sig, err := b64.DecodeString(j.Signature)
+	if err != nil {
+		return errgo.Notef(err, "invalid JWS signature")
+	}
+	input := []byte(j.Protected + "." + j.Payload)
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		var h crypto.Hash
+		switch {
+		case alg == "ES256" && k.Curve == elliptic.P256():
+			h = crypto.SHA256
+		case alg == "ES384" && k.Curve == elliptic.P384():
+			h = crypto.SHA384
+		case alg == "ES512" && k.Curve == elliptic.P521():
+			h = crypto.SHA512
+		default:
+			return errgo.WithCausef(nil, errUnsupportedAlgorithm, "unsupported algorithm %q for key", alg)
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return errgo.New("invalid JWS signature")
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(k, hash(h, input), r, s) {
+			return errgo.New("invalid JWS signature")
+		}
+	case *rsa.PublicKey:
+		var h crypto.Hash
+		switch alg {
+		case "RS256":
+			h = crypto.SHA256
+		case "RS384":
+			h = crypto.SHA384
+		case "RS512":
+			h = crypto.SHA512
+		default:
+			return errgo.WithCausef(nil, errUnsupportedAlgorithm, "unsupported algorithm %q for key", alg)
+		}
+		if err := rsa.VerifyPKCS1v15(k, h, hash(h, input), sig); err != nil {
+			return errgo.New("invalid JWS signature")
+		}
+	case ed25519.PublicKey:
+		if alg != "EdDSA" {
+			return errgo.WithCausef(nil, errUnsupportedAlgorithm, "unsupported algorithm %q for key", alg)
+		}
+		if !ed25519.Verify(k, input, sig) {
+			return errgo.New("invalid JWS signature")
+		}
+	default:
+		return errgo.WithCausef(nil, errUnsupportedAlgorithm, "unsupported key type %T", key)
+	}
+	return nil
+}
+
+func hash(h crypto.Hash, data []byte) []byte {
+	switch h {
+	case crypto.SHA256:
+		sum := sha256.Sum256(data)
+		return sum[:]
+	case crypto.SHA384:
+		sum := sha512.Sum384(data)
+		return sum[:]
+	default:
+		sum := sha512.Sum512(data)
+		return sum[:]
+	}
+}
+
+// parseJWK parses a JSON web key, returning the public key and its
+// RFC 7638 thumbprint.
+func parseJWK(data []byte) (crypto.PublicKey, string, error) {
+	var k jwk
+	if err := json.Unmarshal(data, &k); err != nil {
+		return nil, "", errgo.Notef(err, "invalid JWK")
+	}
+	var key crypto.PublicKey
+	// The thumbprint is calculated from the required members in
+	// lexicographic order. Encoding a struct with fields in the
+	// right order produces exactly that.
+	var tp interface{}
+	switch k.Kty {
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, "", errgo.Newf("unsupported curve %q", k.Crv)
+		}
+		x, err1 := b64.DecodeString(k.X)
+		y, err2 := b64.DecodeString(k.Y)
+		if err1 != nil || err2 != nil {
+			return nil, "", errgo.New("invalid JWK")
+		}
+		pub := &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		if !curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, "", errgo.New("invalid JWK")
+		}
+		key = pub
+		tp = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{k.Crv, k.Kty, k.X, k.Y}
+	case "RSA":
+		n, err1 := b64.DecodeString(k.N)
+		e, err2 := b64.DecodeString(k.E)
+		if err1 != nil || err2 != nil || len(e) > 4 {
+			return nil, "", errgo.New("invalid JWK")
+		}
+		pub := &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+		if pub.N.BitLen() < 2048 {
+			return nil, "", errgo.New("RSA key too small")
+		}
+		key = pub
+		tp = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{k.E, k.Kty, k.N}
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, "", errgo.Newf("unsupported curve %q", k.Crv)
+		}
+		x, err := b64.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, "", errgo.New("invalid JWK")
+		}
+		key = ed25519.PublicKey(x)
+		tp = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{k.Crv, k.Kty, k.X}
+	default:
+		return nil, "", errgo.Newf("unsupported key type %q", k.Kty)
+	}
+	data, err := json.Marshal(tp)
+	if err != nil {
+		return nil, "", errgo.Mask(err)
+	}
+	sum := sha256.Sum256(data)
+	return key, b64.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,1004 @@
+// Package acme implements an RFC 8555 ACME server that issues
+// certificates using a ca.Issuer. Accounts, orders and authorizations
+// are held in memory. Account key rollover (keyChange) and certificate
+// revocation (revokeCert) are not supported, so the directory does not
+// advertise them; certificates may be revoked in the certificate store
+// instead, for example with ca-db.
+package acme
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	errgo "gopkg.in/errgo.v1"
+
+	"github.com/mhilton/ca"
+)
+
+// maxRequestSize is the maximum size of a request body that will be
+// read.
+const maxRequestSize = 64 * 1024
+
+// maxNonces is the maximum number of outstanding nonces.
+const maxNonces = 10000
+
+// purgeInterval is the minimum time between searches for expired
+// orders to remove.
+const purgeInterval = time.Minute
+
+// Params holds the parameters for a Server.
+type Params struct {
+	// Issuer is used to issue certificates.
+	Issuer *ca.Issuer
+
+	// Profile is the profile of issued certificates.
+	Profile *ca.Profile
+
+	// BaseURL is the URL at which the server is reachable, for
+	// example "https://ca.example.com/acme". The directory is at
+	// BaseURL + "/directory".
+	BaseURL string
+
+	// AllowDomain, if set, is called to check whether certificates
+	// may be issued for the given domain.
+	AllowDomain func(domain string) error
+
+	// HTTPClient is used to fetch http-01 challenge responses. If
+	// it is nil a client with a short timeout is used, which only
+	// follows a limited number of redirects to the ports allowed by
+	// RFC 8555 section 8.3.
+	HTTPClient HTTPClient
+
+	// HTTPPort is the port on which http-01 challenge responses are
+	// fetched. If it is zero port 80 is used.
+	HTTPPort int
+
+	// Resolver is used to look up dns-01 challenge responses. If
+	// it is nil net.DefaultResolver is used.
+	Resolver Resolver
+
+	// OrderLifetime is the time for which orders and
+	// authorizations are valid. If it is zero a week is used.
+	// Expired orders, along with their authorizations and
+	// certificates, are removed from the server.
+	OrderLifetime time.Duration
+}
+
+// A Server is an http.Handler that implements an ACME server.
+type Server struct {
+	p        Params
+	basePath string
+
+	mu           sync.Mutex
+	nonces       map[string]bool
+	accounts     map[string]*account
+	thumbprints  map[string]*account
+	orders       map[string]*order
+	authzs       map[string]*authz
+	challenges   map[string]*challenge
+	certificates map[string][]byte
+	lastPurge    time.Time
+}
+
+const (
+	statusPending     = "pending"
+	statusProcessing  = "processing"
+	statusReady       = "ready"
+	statusValid       = "valid"
+	statusInvalid     = "invalid"
+	statusDeactivated = "deactivated"
+)
+
+type account struct {
+	id         string
+	key        crypto.PublicKey
+	thumbprint string
+	status     string
+	contact    []string
+	orders     []string
+}
+
+type identifier struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type order struct {
+	id          string
+	accountID   string
+	status      string
+	expires     time.Time
+	identifiers []identifier
+	authzs      []string
+	certID      string
+	err         *problem
+}
+
+type authz struct {
+	id         string
+	accountID  string
+	status     string
+	expires    time.Time
+	identifier identifier
+	wildcard   bool
+	challenges []*challenge
+}
+
+type challenge struct {
+	id        string
+	authzID   string
+	typ       string
+	token     string
+	status    string
+	validated time.Time
+	err       *problem
+}
+
+// New creates a new ACME server.
+func New(p Params) (*Server, error) {
+	if p.Issuer == nil || p.Profile == nil {
+		return nil, errgo.New("issuer and profile must be specified")
+	}
+	u, err := url.Parse(p.BaseURL)
+	if err != nil || !u.IsAbs() {
+		return nil, errgo.Newf("invalid base URL %q", p.BaseURL)
+	}
+	p.BaseURL = strings.TrimSuffix(p.BaseURL, "/")
+	if p.HTTPClient == nil {
+		p.HTTPClient = &http.Client{
+			Timeout:       10 * time.Second,
+			CheckRedirect: checkRedirect(p.HTTPPort),
+		}
+	}
+	if p.Resolver == nil {
+		p.Resolver = net.DefaultResolver
+	}
+	if p.OrderLifetime == 0 {
+		p.OrderLifetime = 7 * 24 * time.Hour
+	}
+	return &Server{
+		p:            p,
+		basePath:     strings.TrimSuffix(u.Path, "/"),
+		nonces:       make(map[string]bool),
+		accounts:     make(map[string]*account),
+		thumbprints:  make(map[string]*account),
+		orders:       make(map[string]*order),
+		authzs:       make(map[string]*authz),
+		challenges:   make(map[string]*challenge),
+		certificates: make(map[string][]byte),
+	}, nil
+}
+
+func (s *Server) url(kind, id string) string {
+	if id == "" {
+		return s.p.BaseURL + "/" + kind
+	}
+	return s.p.BaseURL + "/" + kind + "/" + id
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Replay-Nonce", s.newNonce())
+	w.Header().Add("Link", fmt.Sprintf("<%s>;rel=\"index\"", s.url("directory", "")))
+	path := strings.TrimPrefix(req.URL.Path, s.basePath+"/")
+	if path == req.URL.Path {
+		writeProblem(w, newProblem("malformed", http.StatusNotFound, "not found"))
+		return
+	}
+	kind, id := path, ""
+	if i := strings.Index(path, "/"); i >= 0 {
+		kind, id = path[:i], path[i+1:]
+	}
+	switch kind {
+	case "directory":
+		if req.Method != "GET" {
+			writeProblem(w, newProblem("malformed", http.StatusMethodNotAllowed, "method not allowed"))
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"newNonce":   s.url("new-nonce", ""),
+			"newAccount": s.url("new-account", ""),
+			"newOrder":   s.url("new-order", ""),
+		})
+	case "new-nonce":
+		w.Header().Set("Cache-Control", "no-store")
+		switch req.Method {
+		case "HEAD":
+			w.WriteHeader(http.StatusOK)
+		case "GET":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			writeProblem(w, newProblem("malformed", http.StatusMethodNotAllowed, "method not allowed"))
+		}
+	default:
+		if req.Method != "POST" {
+			writeProblem(w, newProblem("malformed", http.StatusMethodNotAllowed, "method not allowed"))
+			return
+		}
+		s.servePost(w, req, kind, id)
+	}
+}
+
+// A request holds an authenticated ACME request.
+type request struct {
+	// account holds the account that made the request. It is nil
+	// for new-account requests.
+	account *account
+
+	// key and thumbprint hold the key that signed the request and
+	// its thumbprint if it was given as a JWK.
+	key        crypto.PublicKey
+	thumbprint string
+
+	id      string
+	payload []byte
+}
+
+// postAsGet reports whether the request is a POST-as-GET request.
+func (r *request) postAsGet() bool {
+	return len(r.payload) == 0
+}
+
+// A response holds the response to an ACME request.
+type response struct {
+	status      int
+	location    string
+	up          string
+	contentType string
+	body        interface{}
+}
+
+var handlers = map[string]func(s *Server, ctx context.Context, r *request) (*response, error){
+	"new-account": (*Server).newAccount,
+	"account":     (*Server).updateAccount,
+	"orders":      (*Server).listOrders,
+	"new-order":   (*Server).newOrder,
+	"order":       (*Server).getOrder,
+	"authz":       (*Server).getAuthz,
+	"chall":       (*Server).postChallenge,
+	"finalize":    (*Server).finalize,
+	"cert":        (*Server).getCertificate,
+}
+
+// postAsGetOnly holds the kinds of resource that may only be fetched
+// with POST-as-GET requests (RFC 8555 section 6.3).
+var postAsGetOnly = map[string]bool{
+	"orders": true,
+	"order":  true,
+	"cert":   true,
+}
+
+func (s *Server) servePost(w http.ResponseWriter, req *http.Request, kind, id string) {
+	h, ok := handlers[kind]
+	if !ok {
+		writeProblem(w, newProblem("malformed", http.StatusNotFound, "not found"))
+		return
+	}
+	r, err := s.authenticate(req, kind, id)
+	if err != nil {
+		writeProblem(w, err)
+		return
+	}
+	if postAsGetOnly[kind] && !r.postAsGet() {
+		writeProblem(w, newProblem("malformed", http.StatusBadRequest, "%s requests must be POST-as-GET", kind))
+		return
+	}
+	resp, err := h(s, req.Context(), r)
+	if err != nil {
+		writeProblem(w, err)
+		return
+	}
+	if resp.location != "" {
+		w.Header().Set("Location", resp.location)
+	}
+	if resp.up != "" {
+		w.Header().Add("Link", fmt.Sprintf("<%s>;rel=\"up\"", resp.up))
+	}
+	if resp.contentType != "" {
+		w.Header().Set("Content-Type", resp.contentType)
+		w.WriteHeader(resp.status)
+		w.Write(resp.body.([]byte))
+		return
+	}
+	writeJSON(w, resp.status, resp.body)
+}
+
+// authenticate checks the JWS in the request body and returns the
+// authenticated request.
+func (s *Server) authenticate(req *http.Request, kind, id string) (*request, error) {
+	if ct := req.Header.Get("Content-Type"); ct != "application/jose+json" {
+		return nil, newProblem("malformed", http.StatusUnsupportedMediaType, "unsupported content type %q", ct)
+	}
+	data, err := ioutil.ReadAll(http.MaxBytesReader(nil, req.Body, maxRequestSize))
+	if err != nil {
+		return nil, newProblem("malformed", http.StatusBadRequest, "cannot read request")
+	}
+	j, h, payload, err := parseJWS(data)
+	if err != nil {
+		return nil, newProblem("malformed", http.StatusBadRequest, "%s", err)
+	}
+	if h.URL != s.url(kind, id) {
+		return nil, newProblem("unauthorized", http.StatusUnauthorized, "JWS url %q does not match request URL", h.URL)
+	}
+	if !s.useNonce(h.Nonce) {
+		return nil, newProblem("badNonce", http.StatusBadRequest, "invalid nonce")
+	}
+	r := &request{
+		id:      id,
+		payload: payload,
+	}
+	if kind == "new-account" {
+		if len(h.JWK) == 0 || h.KID != "" {
+			return nil, newProblem("malformed", http.StatusBadRequest, "new account requests must include a JWK")
+		}
+		r.key, r.thumbprint, err = parseJWK(h.JWK)
+		if err != nil {
+			return nil, newProblem("badPublicKey", http.StatusBadRequest, "%s", err)
+		}
+	} else {
+		if len(h.JWK) != 0 || h.KID == "" {
+			return nil, newProblem("malformed", http.StatusBadRequest, "requests must include a key ID")
+		}
+		s.mu.Lock()
+		r.account = s.accounts[strings.TrimPrefix(h.KID, s.url("account", "")+"/")]
+		var status string
+		if r.account != nil {
+			status = r.account.status
+			r.key = r.account.key
+		}
+		s.mu.Unlock()
+		if r.account == nil {
+			return nil, newProblem("accountDoesNotExist", http.StatusBadRequest, "unknown account")
+		}
+		if status != statusValid {
+			return nil, newProblem("unauthorized", http.StatusUnauthorized, "account is %s", status)
+		}
+	}
+	if err := j.verify(h.Alg, r.key); err != nil {
+		if errgo.Cause(err) == errUnsupportedAlgorithm {
+			return nil, newProblem("badSignatureAlgorithm", http.StatusBadRequest, "%s", err)
+		}
+		return nil, newProblem("malformed", http.StatusBadRequest, "%s", err)
+	}
+	return r, nil
+}
+
+func (s *Server) newAccount(ctx context.Context, r *request) (*response, error) {
+	var p struct {
+		Contact              []string `json:"contact"`
+		TermsOfServiceAgreed bool     `json:"termsOfServiceAgreed"`
+		OnlyReturnExisting   bool     `json:"onlyReturnExisting"`
+	}
+	if err := json.Unmarshal(r.payload, &p); err != nil {
+		return nil, newProblem("malformed", http.StatusBadRequest, "invalid request: %s", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if acct := s.thumbprints[r.thumbprint]; acct != nil {
+		if acct.status != statusValid {
+			return nil, newProblem("unauthorized", http.StatusUnauthorized, "account is %s", acct.status)
+		}
+		return &response{
+			status:   http.StatusOK,
+			location: s.url("account", acct.id),
+			body:     s.accountJSON(acct),
+		}, nil
+	}
+	if p.OnlyReturnExisting {
+		return nil, newProblem("accountDoesNotExist", http.StatusBadRequest, "no account exists with the given key")
+	}
+	if err := checkContact(p.Contact); err != nil {
+		return nil, err
+	}
+	acct := &account{
+		id:         newID(),
+		key:        r.key,
+		thumbprint: r.thumbprint,
+		status:     statusValid,
+		contact:    p.Contact,
+	}
+	s.accounts[acct.id] = acct
+	s.thumbprints[acct.thumbprint] = acct
+	return &response{
+		status:   http.StatusCreated,
+		location: s.url("account", acct.id),
+		body:     s.accountJSON(acct),
+	}, nil
+}
+
+func (s *Server) updateAccount(ctx context.Context, r *request) (*response, error) {
+	if r.id != r.account.id {
+		return nil, newProblem("unauthorized", http.StatusUnauthorized, "account does not match key")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !r.postAsGet() {
+		var p struct {
+			Contact []string `json:"contact"`
+			Status  string   `json:"status"`
+		}
+		if err := json.Unmarshal(r.payload, &p); err != nil {
+			return nil, newProblem("malformed", http.StatusBadRequest, "invalid request: %s", err)
+		}
+		if p.Contact != nil {
+			if err := checkContact(p.Contact); err != nil {
+				return nil, err
+			}
+			r.account.contact = p.Contact
+		}
+		switch p.Status {
+		case "":
+		case statusDeactivated:
+			r.account.status = statusDeactivated
+		default:
+			return nil, newProblem("malformed", http.StatusBadRequest, "cannot change account status to %q", p.Status)
+		}
+	}
+	return &response{
+		status: http.StatusOK,
+		body:   s.accountJSON(r.account),
+	}, nil
+}
+
+func checkContact(contact []string) error {
+	for _, c := range contact {
+		if !strings.HasPrefix(c, "mailto:") {
+			return newProblem("unsupportedContact", http.StatusBadRequest, "unsupported contact %q", c)
+		}
+	}
+	return nil
+}
+
+func (s *Server) listOrders(ctx context.Context, r *request) (*response, error) {
+	if r.id != r.account.id {
+		return nil, newProblem("unauthorized", http.StatusUnauthorized, "account does not match key")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	urls := []string{}
+	for _, id := range r.account.orders {
+		urls = append(urls, s.url("order", id))
+	}
+	return &response{
+		status: http.StatusOK,
+		body: map[string]interface{}{
+			"orders": urls,
+		},
+	}, nil
+}
+
+func (s *Server) newOrder(ctx context.Context, r *request) (*response, error) {
+	var p struct {
+		Identifiers []identifier `json:"identifiers"`
+		NotBefore   string       `json:"notBefore"`
+		NotAfter    string       `json:"notAfter"`
+	}
+	if err := json.Unmarshal(r.payload, &p); err != nil {
+		return nil, newProblem("malformed", http.StatusBadRequest, "invalid request: %s", err)
+	}
+	if p.NotBefore != "" || p.NotAfter != "" {
+		return nil, newProblem("malformed", http.StatusBadRequest, "notBefore and notAfter are not supported")
+	}
+	if len(p.Identifiers) == 0 {
+		return nil, newProblem("malformed", http.StatusBadRequest, "no identifiers specified")
+	}
+	seen := make(map[string]bool)
+	var ids []identifier
+	for _, id := range p.Identifiers {
+		if id.Type != "dns" {
+			return nil, newProblem("unsupportedIdentifier", http.StatusBadRequest, "unsupported identifier type %q", id.Type)
+		}
+		name := strings.ToLower(id.Value)
+		if err := checkDomain(strings.TrimPrefix(name, "*.")); err != nil {
+			return nil, newProblem("rejectedIdentifier", http.StatusBadRequest, "%s", err)
+		}
+		if s.p.AllowDomain != nil {
+			if err := s.p.AllowDomain(name); err != nil {
+				return nil, newProblem("rejectedIdentifier", http.StatusBadRequest, "%s", err)
+			}
+		}
+		if !seen[name] {
+			seen[name] = true
+			ids = append(ids, identifier{Type: "dns", Value: name})
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.purge(now)
+	o := &order{
+		id:          newID(),
+		accountID:   r.account.id,
+		status:      statusPending,
+		expires:     now.Add(s.p.OrderLifetime),
+		identifiers: ids,
+	}
+	for _, id := range ids {
+		a := &authz{
+			id:         newID(),
+			accountID:  r.account.id,
+			status:     statusPending,
+			expires:    o.expires,
+			identifier: id,
+		}
+		types := []string{"http-01", "dns-01"}
+		if strings.HasPrefix(id.Value, "*.") {
+			a.identifier.Value = strings.TrimPrefix(id.Value, "*.")
+			a.wildcard = true
+			types = []string{"dns-01"}
+		}
+		for _, t := range types {
+			c := &challenge{
+				id:      newID(),
+				authzID: a.id,
+				typ:     t,
+				token:   newID(),
+				status:  statusPending,
+			}
+			a.challenges = append(a.challenges, c)
+			s.challenges[c.id] = c
+		}
+		s.authzs[a.id] = a
+		o.authzs = append(o.authzs, a.id)
+	}
+	s.orders[o.id] = o
+	r.account.orders = append(r.account.orders, o.id)
+	return &response{
+		status:   http.StatusCreated,
+		location: s.url("order", o.id),
+		body:     s.orderJSON(o),
+	}, nil
+}
+
+// checkDomain checks that name is a syntactically valid domain name.
+func checkDomain(name string) error {
+	if len(name) == 0 || len(name) > 253 || net.ParseIP(name) != nil {
+		return errgo.Newf("invalid domain name %q", name)
+	}
+	for _, label := range strings.Split(name, ".") {
+		if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return errgo.Newf("invalid domain name %q", name)
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+				return errgo.Newf("invalid domain name %q", name)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Server) getOrder(ctx context.Context, r *request) (*response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o := s.orders[r.id]
+	if o == nil || o.accountID != r.account.id {
+		return nil, newProblem("malformed", http.StatusNotFound, "order not found")
+	}
+	return &response{
+		status: http.StatusOK,
+		body:   s.orderJSON(o),
+	}, nil
+}
+
+func (s *Server) getAuthz(ctx context.Context, r *request) (*response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := s.authzs[r.id]
+	if a == nil || a.accountID != r.account.id {
+		return nil, newProblem("malformed", http.StatusNotFound, "authorization not found")
+	}
+	if !r.postAsGet() {
+		var p struct {
+			Status string `json:"status"`
+		}
+		if err := json.Unmarshal(r.payload, &p); err != nil {
+			return nil, newProblem("malformed", http.StatusBadRequest, "invalid request: %s", err)
+		}
+		if p.Status != statusDeactivated {
+			return nil, newProblem("malformed", http.StatusBadRequest, "cannot change authorization status to %q", p.Status)
+		}
+		a.status = statusDeactivated
+	}
+	return &response{
+		status: http.StatusOK,
+		body:   s.authzJSON(a),
+	}, nil
+}
+
+func (s *Server) postChallenge(ctx context.Context, r *request) (*response, error) {
+	s.mu.Lock()
+	c := s.challenges[r.id]
+	var a *authz
+	if c != nil {
+		a = s.authzs[c.authzID]
+	}
+	if a == nil || a.accountID != r.account.id {
+		s.mu.Unlock()
+		return nil, newProblem("malformed", http.StatusNotFound, "challenge not found")
+	}
+	s.expireAuthz(a)
+	if r.postAsGet() || c.status != statusPending || a.status != statusPending {
+		defer s.mu.Unlock()
+		return &response{
+			status: http.StatusOK,
+			up:     s.url("authz", a.id),
+			body:   s.challengeJSON(c),
+		}, nil
+	}
+	c.status = statusProcessing
+	domain := a.identifier.Value
+	keyAuth := c.token + "." + r.account.thumbprint
+	s.mu.Unlock()
+
+	var err error
+	switch c.typ {
+	case "http-01":
+		err = s.validateHTTP01(ctx, domain, c.token, keyAuth)
+	case "dns-01":
+		err = s.validateDNS01(ctx, domain, keyAuth)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		c.status = statusInvalid
+		c.err = newProblem(problemType(c.typ), http.StatusForbidden, "%s", err)
+		a.status = statusInvalid
+	} else {
+		c.status = statusValid
+		c.validated = time.Now()
+		a.status = statusValid
+	}
+	return &response{
+		status: http.StatusOK,
+		up:     s.url("authz", a.id),
+		body:   s.challengeJSON(c),
+	}, nil
+}
+
+func problemType(challengeType string) string {
+	if challengeType == "dns-01" {
+		return "dns"
+	}
+	return "incorrectResponse"
+}
+
+func (s *Server) finalize(ctx context.Context, r *request) (*response, error) {
+	var p struct {
+		CSR string `json:"csr"`
+	}
+	if err := json.Unmarshal(r.payload, &p); err != nil {
+		return nil, newProblem("malformed", http.StatusBadRequest, "invalid request: %s", err)
+	}
+	der, err := b64.DecodeString(p.CSR)
+	if err != nil {
+		return nil, newProblem("badCSR", http.StatusBadRequest, "invalid CSR encoding")
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return nil, newProblem("badCSR", http.StatusBadRequest, "invalid CSR: %s", err)
+	}
+	// Check the CSR here so that any remaining failure to issue is
+	// the fault of the server rather than the client.
+	if err := csr.CheckSignature(); err != nil {
+		return nil, newProblem("badCSR", http.StatusBadRequest, "invalid CSR signature: %s", err)
+	}
+	if err := s.p.Profile.CheckRequest(csr); err != nil {
+		return nil, newProblem("badCSR", http.StatusBadRequest, "%s", err)
+	}
+
+	s.mu.Lock()
+	o := s.orders[r.id]
+	if o == nil || o.accountID != r.account.id {
+		s.mu.Unlock()
+		return nil, newProblem("malformed", http.StatusNotFound, "order not found")
+	}
+	s.updateOrder(o)
+	if o.status != statusReady {
+		s.mu.Unlock()
+		return nil, newProblem("orderNotReady", http.StatusForbidden, "order is %s", o.status)
+	}
+	if err := checkCSRNames(csr, o.identifiers); err != nil {
+		s.mu.Unlock()
+		return nil, newProblem("badCSR", http.StatusBadRequest, "%s", err)
+	}
+	o.status = statusProcessing
+	s.mu.Unlock()
+
+	crt, err := s.p.Issuer.Issue(ctx, csr, s.p.Profile)
+	var chain []byte
+	if err == nil {
+		chain, err = encodeChain(append([]*x509.Certificate{crt}, s.p.Issuer.Chain()...))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		o.status = statusInvalid
+		o.err = newProblem("serverInternal", http.StatusInternalServerError, "cannot issue certificate: %s", err)
+		return nil, o.err
+	}
+	o.certID = newID()
+	o.status = statusValid
+	s.certificates[o.certID] = chain
+	return &response{
+		status:   http.StatusOK,
+		location: s.url("order", o.id),
+		body:     s.orderJSON(o),
+	}, nil
+}
+
+// checkCSRNames checks that the names in the CSR match the identifiers
+// in an order.
+func checkCSRNames(csr *x509.CertificateRequest, ids []identifier) error {
+	if len(csr.EmailAddresses) > 0 || len(csr.IPAddresses) > 0 || len(csr.URIs) > 0 {
+		return errgo.New("CSR contains unsupported subject alternative names")
+	}
+	want := make(map[string]bool)
+	for _, id := range ids {
+		want[id.Value] = true
+	}
+	got := make(map[string]bool)
+	for _, n := range csr.DNSNames {
+		got[strings.ToLower(n)] = true
+	}
+	if cn := strings.ToLower(csr.Subject.CommonName); cn != "" {
+		if !want[cn] {
+			return errgo.Newf("CSR common name %q is not in order", cn)
+		}
+		got[cn] = true
+	}
+	if len(got) != len(want) {
+		return errgo.New("CSR names do not match order")
+	}
+	for n := range got {
+		if !want[n] {
+			return errgo.Newf("CSR name %q is not in order", n)
+		}
+	}
+	return nil
+}
+
+func encodeChain(crts []*x509.Certificate) ([]byte, error) {
+	var buf strings.Builder
+	if err := ca.WriteCertificates(&buf, crts); err != nil {
+		return nil, errgo.Mask(err)
+	}
+	return []byte(buf.String()), nil
+}
+
+func (s *Server) getCertificate(ctx context.Context, r *request) (*response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var found bool
+	for _, id := range r.account.orders {
+		if s.orders[id].certID == r.id {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, newProblem("malformed", http.StatusNotFound, "certificate not found")
+	}
+	return &response{
+		status:      http.StatusOK,
+		contentType: "application/pem-certificate-chain",
+		body:        s.certificates[r.id],
+	}, nil
+}
+
+// purge removes orders that expired before now, along with their
+// authorizations, challenges and certificates. To limit its cost it
+// does nothing if it was last called less than purgeInterval ago. s.mu
+// must be held.
+func (s *Server) purge(now time.Time) {
+	if now.Sub(s.lastPurge) < purgeInterval {
+		return
+	}
+	s.lastPurge = now
+	for id, o := range s.orders {
+		if now.Before(o.expires) {
+			continue
+		}
+		for _, aid := range o.authzs {
+			if a := s.authzs[aid]; a != nil {
+				for _, c := range a.challenges {
+					delete(s.challenges, c.id)
+				}
+			}
+			delete(s.authzs, aid)
+		}
+		delete(s.certificates, o.certID)
+		delete(s.orders, id)
+	}
+	for _, a := range s.accounts {
+		var orders []string
+		for _, id := range a.orders {
+			if s.orders[id] != nil {
+				orders = append(orders, id)
+			}
+		}
+		a.orders = orders
+	}
+}
+
+// expireAuthz marks a if it has expired. s.mu must be held.
+func (s *Server) expireAuthz(a *authz) {
+	if (a.status == statusPending || a.status == statusValid) && time.Now().After(a.expires) {
+		a.status = "expired"
+	}
+}
+
+// updateOrder updates the status of o from its authorizations. s.mu
+// must be held.
+func (s *Server) updateOrder(o *order) {
+	if o.status != statusPending {
+		return
+	}
+	if time.Now().After(o.expires) {
+		o.status = statusInvalid
+		return
+	}
+	ready := true
+	for _, id := range o.authzs {
+		a := s.authzs[id]
+		s.expireAuthz(a)
+		switch a.status {
+		case statusValid:
+		case statusPending:
+			ready = false
+		default:
+			o.status = statusInvalid
+			return
+		}
+	}
+	if ready {
+		o.status = statusReady
+	}
+}
+
+func (s *Server) accountJSON(a *account) interface{} {
+	return map[string]interface{}{
+		"status":  a.status,
+		"contact": a.contact,
+		"orders":  s.url("orders", a.id),
+	}
+}
+
+func (s *Server) orderJSON(o *order) interface{} {
+	s.updateOrder(o)
+	authzs := make([]string, len(o.authzs))
+	for i, id := range o.authzs {
+		authzs[i] = s.url("authz", id)
+	}
+	v := map[string]interface{}{
+		"status":         o.status,
+		"expires":        o.expires.UTC().Format(time.RFC3339),
+		"identifiers":    o.identifiers,
+		"authorizations": authzs,
+		"finalize":       s.url("finalize", o.id),
+	}
+	if o.certID != "" {
+		v["certificate"] = s.url("cert", o.certID)
+	}
+	if o.err != nil {
+		v["error"] = o.err
+	}
+	return v
+}
+
+func (s *Server) authzJSON(a *authz) interface{} {
+	s.expireAuthz(a)
+	challenges := make([]interface{}, len(a.challenges))
+	for i, c := range a.challenges {
+		challenges[i] = s.challengeJSON(c)
+	}
+	v := map[string]interface{}{
+		"status":     a.status,
+		"expires":    a.expires.UTC().Format(time.RFC3339),
+		"identifier": a.identifier,
+		"challenges": challenges,
+	}
+	if a.wildcard {
+		v["wildcard"] = true
+	}
+	return v
+}
+
+func (s *Server) challengeJSON(c *challenge) interface{} {
+	v := map[string]interface{}{
+		"type":   c.typ,
+		"url":    s.url("chall", c.id),
+		"status": c.status,
+		"token":  c.token,
+	}
+	if !c.validated.IsZero() {
+		v["validated"] = c.validated.UTC().Format(time.RFC3339)
+	}
+	if c.err != nil {
+		v["error"] = c.err
+	}
+	return v
+}
+
+func (s *Server) newNonce() string {
+	n := newID()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.nonces) >= maxNonces {
+		// Discard an arbitrary nonce, clients using it will get
+		// a badNonce error and retry.
+		for k := range s.nonces {
+			delete(s.nonces, k)
+			break
+		}
+	}
+	s.nonces[n] = true
+	return n
+}
+
+func (s *Server) useNonce(n string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.nonces[n] {
+		return false
+	}
+	delete(s.nonces, n)
+	return true
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return b64.EncodeToString(b)
+}
+
+// problem is an RFC 7807 problem document.
+type problem struct {
+	Type   string `json:"type"`
+	Detail string `json:"detail"`
+	Status int    `json:"status"`
+}
+
+func newProblem(typ string, status int, format string, args ...interface{}) *problem {
+	return &problem{
+		Type:   "urn:ietf:params:acme:error:" + typ,
+		Detail: fmt.Sprintf(format, args...),
+		Status: status,
+	}
+}
+
+func (p *problem) Error() string {
+	return p.Detail
+}
+
+func writeProblem(w http.ResponseWriter, err error) {
+	p, ok := err.(*problem)
+	if !ok {
+		p = newProblem("serverInternal", http.StatusInternalServerError, "%s", err)
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
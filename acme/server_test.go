@@ -0,0 +1,262 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	xacme "golang.org/x/crypto/acme"
+	errgo "gopkg.in/errgo.v1"
+
+	"github.com/mhilton/ca"
+)
+
+// newTestServer starts an ACME server and returns it along with a
+// client for a new account registered with it.
+func newTestServer(t *testing.T) (*Server, *xacme.Client) {
+	key, err := ca.GenerateECDSAKey(elliptic.P256())
+	if err != nil {
+		t.Fatal(err)
+	}
+	crt, err := ca.SelfSignCertificate(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iss, err := ca.NewIssuer(crt, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	profile, err := ca.BuiltinProfile("server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var srv *Server
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		srv.ServeHTTP(w, req)
+	}))
+	t.Cleanup(ts.Close)
+	srv, err = New(Params{
+		Issuer:  iss,
+		Profile: profile,
+		BaseURL: ts.URL + "/acme",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	accountKey, err := ca.GenerateECDSAKey(elliptic.P256())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &xacme.Client{
+		Key:          accountKey,
+		DirectoryURL: ts.URL + "/acme/directory",
+	}
+	if _, err := client.Register(context.Background(), &xacme.Account{}, xacme.AcceptTOS); err != nil {
+		t.Fatal(err)
+	}
+	return srv, client
+}
+
+func TestDeactivatedAccount(t *testing.T) {
+	ctx := context.Background()
+	_, client := newTestServer(t)
+	if err := client.DeactivateReg(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Register(ctx, &xacme.Account{}, xacme.AcceptTOS); err == nil {
+		t.Errorf("expected error registering deactivated account")
+	}
+	if _, err := client.AuthorizeOrder(ctx, xacme.DomainIDs("example.com")); err == nil {
+		t.Errorf("expected error creating order for deactivated account")
+	}
+}
+
+func TestPurgeExpiredOrders(t *testing.T) {
+	ctx := context.Background()
+	srv, client := newTestServer(t)
+	o, err := client.AuthorizeOrder(ctx, xacme.DomainIDs("example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.mu.Lock()
+	srv.purge(time.Now())
+	n := len(srv.orders)
+	srv.purge(time.Now().Add(srv.p.OrderLifetime + purgeInterval))
+	srv.mu.Unlock()
+	if n != 1 {
+		t.Errorf("unexpired order purged")
+	}
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if len(srv.orders) != 0 || len(srv.authzs) != 0 || len(srv.challenges) != 0 {
+		t.Errorf("expired order not purged: %d orders, %d authorizations, %d challenges", len(srv.orders), len(srv.authzs), len(srv.challenges))
+	}
+	for _, a := range srv.accounts {
+		if len(a.orders) != 0 {
+			t.Errorf("account still lists order %s", o.URI)
+		}
+	}
+}
+
+// post sends a JWS signed by key to the given URL on behalf of the
+// account with the given key ID. If corrupt is true the signature is
+// invalidated.
+func post(t *testing.T, srv *Server, key *ecdsa.PrivateKey, kid, url string, payload []byte, corrupt bool) (*http.Response, *problem) {
+	resp, err := http.Head(srv.url("new-nonce", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	protected, err := json.Marshal(map[string]string{
+		"alg":   "ES256",
+		"nonce": resp.Header.Get("Replay-Nonce"),
+		"url":   url,
+		"kid":   kid,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	j := jws{
+		Protected: b64.EncodeToString(protected),
+		Payload:   b64.EncodeToString(payload),
+	}
+	sum := sha256.Sum256([]byte(j.Protected + "." + j.Payload))
+	r, s, err := ecdsa.Sign(rand.Reader, key, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	if corrupt {
+		sig[0] ^= 0xff
+	}
+	j.Signature = b64.EncodeToString(sig)
+	body, err := json.Marshal(j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = http.Post(url, "application/jose+json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var p *problem
+	if resp.StatusCode >= 400 {
+		p = new(problem)
+		if err := json.NewDecoder(resp.Body).Decode(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp, p
+}
+
+func TestRequestErrors(t *testing.T) {
+	ctx := context.Background()
+	srv, client := newTestServer(t)
+	acct, err := client.GetReg(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, err := client.AuthorizeOrder(ctx, xacme.DomainIDs("example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := client.Key.(*ecdsa.PrivateKey)
+	tests := []struct {
+		about      string
+		url        string
+		payload    string
+		corrupt    bool
+		wantStatus int
+		wantType   string
+	}{{
+		about:      "POST-as-GET order",
+		url:        o.URI,
+		wantStatus: http.StatusOK,
+	}, {
+		about:      "order with payload",
+		url:        o.URI,
+		payload:    "{}",
+		wantStatus: http.StatusBadRequest,
+		wantType:   "malformed",
+	}, {
+		about:      "bad signature",
+		url:        o.URI,
+		corrupt:    true,
+		wantStatus: http.StatusBadRequest,
+		wantType:   "malformed",
+	}}
+	for _, test := range tests {
+		t.Run(test.about, func(t *testing.T) {
+			resp, p := post(t, srv, key, acct.URI, test.url, []byte(test.payload), test.corrupt)
+			if resp.StatusCode != test.wantStatus {
+				t.Fatalf("got status %d, want %d (%v)", resp.StatusCode, test.wantStatus, p)
+			}
+			if test.wantType != "" && p.Type != "urn:ietf:params:acme:error:"+test.wantType {
+				t.Errorf("got problem type %q, want %q", p.Type, test.wantType)
+			}
+		})
+	}
+}
+
+func TestVerifyUnsupportedAlgorithm(t *testing.T) {
+	key, err := ca.GenerateECDSAKey(elliptic.P256())
+	if err != nil {
+		t.Fatal(err)
+	}
+	j := &jws{Signature: b64.EncodeToString(make([]byte, 64))}
+	err = j.verify("RS256", key.Public())
+	if errgo.Cause(err) != errUnsupportedAlgorithm {
+		t.Errorf("got error %v, want cause errUnsupportedAlgorithm", err)
+	}
+	err = j.verify("ES256", key.Public())
+	if err == nil || errgo.Cause(err) == errUnsupportedAlgorithm {
+		t.Errorf("got error %v, want invalid signature", err)
+	}
+}
+
+func TestCheckRedirect(t *testing.T) {
+	tests := []struct {
+		url     string
+		port    int
+		via     int
+		wantErr bool
+	}{
+		{url: "http://example.com/x"},
+		{url: "https://example.com/x"},
+		{url: "http://example.com:80/x"},
+		{url: "https://example.com:443/x"},
+		{url: "ftp://example.com/x", wantErr: true},
+		{url: "http://example.com:8080/x", wantErr: true},
+		{url: "http://example.com:8080/x", port: 8080},
+		{url: "http://example.com/x", via: maxRedirects, wantErr: true},
+	}
+	for _, test := range tests {
+		req, err := http.NewRequest("GET", test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = checkRedirect(test.port)(req, make([]*http.Request, test.via))
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s (port %d, %d redirects): got error %v", test.url, test.port, test.via, err)
+		}
+	}
+}
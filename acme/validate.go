@@ -0,0 +1,106 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+
+	errgo "gopkg.in/errgo.v1"
+)
+
+// HTTPClient is the interface used to fetch http-01 challenge
+// responses. It is implemented by *http.Client.
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Resolver is the interface used to look up dns-01 challenge
+// responses. It is implemented by *net.Resolver.
+type Resolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// maxChallengeResponseSize is the maximum size of an http-01
+// challenge response that will be read.
+const maxChallengeResponseSize = 1024
+
+// maxRedirects is the maximum number of redirects followed when
+// fetching an http-01 challenge response.
+const maxRedirects = 10
+
+// checkRedirect returns a function for use as
+// http.Client.CheckRedirect when fetching http-01 challenge responses.
+// As required by RFC 8555 section 8.3 only redirects to http or https
+// URLs on ports 80 and 443 are followed, along with the given port if
+// it is not zero.
+func checkRedirect(port int) func(req *http.Request, via []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if len(via) >= maxRedirects {
+			return errgo.Newf("stopped after %d redirects", maxRedirects)
+		}
+		if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+			return errgo.Newf("redirect to unsupported scheme %q", req.URL.Scheme)
+		}
+		switch p := req.URL.Port(); p {
+		case "", "80", "443":
+		default:
+			if port == 0 || p != strconv.Itoa(port) {
+				return errgo.Newf("redirect to unsupported port %s", p)
+			}
+		}
+		return nil
+	}
+}
+
+// validateHTTP01 validates an http-01 challenge for the given domain.
+func (s *Server) validateHTTP01(ctx context.Context, domain, token, keyAuth string) error {
+	host := domain
+	if s.p.HTTPPort != 0 {
+		host = net.JoinHostPort(domain, strconv.Itoa(s.p.HTTPPort))
+	}
+	req, err := http.NewRequest("GET", fmt.Sprintf("http://%s/.well-known/acme-challenge/%s", host, token), nil)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	resp, err := s.p.HTTPClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return errgo.Notef(err, "cannot fetch challenge response")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errgo.Newf("unexpected status %q fetching challenge response", resp.Status)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxChallengeResponseSize+1))
+	if err != nil {
+		return errgo.Notef(err, "cannot read challenge response")
+	}
+	if len(body) > maxChallengeResponseSize {
+		return errgo.New("challenge response too large")
+	}
+	if !bytes.Equal(bytes.TrimSpace(body), []byte(keyAuth)) {
+		return errgo.New("incorrect challenge response")
+	}
+	return nil
+}
+
+// validateDNS01 validates a dns-01 challenge for the given domain.
+func (s *Server) validateDNS01(ctx context.Context, domain, keyAuth string) error {
+	sum := sha256.Sum256([]byte(keyAuth))
+	want := b64.EncodeToString(sum[:])
+	txts, err := s.p.Resolver.LookupTXT(ctx, "_acme-challenge."+domain)
+	if err != nil {
+		return errgo.Notef(err, "cannot look up TXT record")
+	}
+	for _, txt := range txts {
+		if txt == want {
+			return nil
+		}
+	}
+	return errgo.New("no matching TXT record found")
+}
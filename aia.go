@@ -0,0 +1,98 @@
+package ca
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	errgo "gopkg.in/errgo.v1"
+)
+
+// maxAIADepth is the maximum number of issuers that FetchIssuers will
+// fetch.
+const maxAIADepth = 10
+
+// maxAIASize is the maximum size of a certificate that FetchIssuers
+// will read.
+const maxAIASize = 1 << 20
+
+// defaultAIAClient is used by FetchIssuers when no client is given. It
+// has a timeout so that an unresponsive server cannot stall the caller
+// indefinitely.
+var defaultAIAClient = &http.Client{
+	Timeout: 30 * time.Second,
+}
+
+// FetchIssuers completes the chain for crt by following the issuing
+// certificate URLs in its authority information access extension, and
+// those of each fetched issuer in turn. Fetching stops at a
+// self-signed certificate or one that has no issuing certificate URL.
+// The fetched certificates are returned in chain order, not including
+// crt. Each fetched certificate must have signed the one before it.
+// The issuers may be served in PEM or DER form. If client is nil a
+// client with a 30 second timeout is used.
+func FetchIssuers(ctx context.Context, client *http.Client, crt *x509.Certificate) ([]*x509.Certificate, error) {
+	if client == nil {
+		client = defaultAIAClient
+	}
+	var chain []*x509.Certificate
+	for len(crt.IssuingCertificateURL) > 0 && !bytes.Equal(crt.RawIssuer, crt.RawSubject) {
+		if len(chain) == maxAIADepth {
+			return nil, errgo.New("issuer chain too long")
+		}
+		issuer, err := fetchIssuer(ctx, client, crt)
+		if err != nil {
+			return nil, errgo.Notef(err, "cannot fetch issuer of %q", crt.Subject)
+		}
+		chain = append(chain, issuer)
+		crt = issuer
+	}
+	return chain, nil
+}
+
+// fetchIssuer fetches the issuer of crt, trying each issuing
+// certificate URL in turn.
+func fetchIssuer(ctx context.Context, client *http.Client, crt *x509.Certificate) (*x509.Certificate, error) {
+	var err error
+	for _, u := range crt.IssuingCertificateURL {
+		var issuer *x509.Certificate
+		issuer, err = fetchCertificate(ctx, client, u)
+		if err != nil {
+			continue
+		}
+		if err = crt.CheckSignatureFrom(issuer); err != nil {
+			err = errgo.Notef(err, "certificate from %s is not the issuer", u)
+			continue
+		}
+		return issuer, nil
+	}
+	return nil, err
+}
+
+func fetchCertificate(ctx context.Context, client *http.Client, u string) (*x509.Certificate, error) {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errgo.Newf("cannot fetch %s: %s", u, resp.Status)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxAIASize))
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot fetch %s", u)
+	}
+	crts, err := ReadCertificates(bytes.NewReader(data))
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot read certificate from %s", u)
+	}
+	return crts[0], nil
+}
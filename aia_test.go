@@ -0,0 +1,154 @@
+package ca
+
+import (
+	"bytes"
+	"context"
+	"crypto/elliptic"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFetchIssuers(t *testing.T) {
+	ctx := context.Background()
+	// files holds the responses served, keyed by path.
+	files := make(map[string][]byte)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		data, ok := files[req.URL.Path]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		w.Write(data)
+	}))
+	defer srv.Close()
+	der := func(crt *x509.Certificate) []byte {
+		return crt.Raw
+	}
+	pemData := func(crt *x509.Certificate) []byte {
+		var buf bytes.Buffer
+		if err := WriteCertificate(&buf, crt); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	// issue issues a certificate from iss with the given issuing
+	// certificate paths. If isCA is true it also returns an issuer for
+	// the certificate.
+	issue := func(iss *Issuer, cn string, isCA bool, paths ...string) (*x509.Certificate, *Issuer) {
+		key, err := GenerateECDSAKey(elliptic.P256())
+		if err != nil {
+			t.Fatal(err)
+		}
+		template := &x509.Certificate{
+			Subject:               pkix.Name{CommonName: cn},
+			NotBefore:             time.Now(),
+			NotAfter:              time.Now().Add(time.Hour),
+			IsCA:                  isCA,
+			BasicConstraintsValid: true,
+			KeyUsage:              x509.KeyUsageDigitalSignature,
+		}
+		if isCA {
+			template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+		}
+		for _, p := range paths {
+			template.IssuingCertificateURL = append(template.IssuingCertificateURL, srv.URL+p)
+		}
+		crt, err := iss.IssueFor(ctx, key.Public(), template)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !isCA {
+			return crt, nil
+		}
+		next, err := NewIssuer(crt, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return crt, next
+	}
+
+	root := newTestIssuer(t)
+	files["/root.pem"] = pemData(root.Certificate())
+	_, intermediate := issue(root, "intermediate", true, "/root.pem")
+	files["/intermediate.der"] = der(intermediate.Certificate())
+	files["/intermediate.pem"] = pemData(intermediate.Certificate())
+	files["/other.pem"] = pemData(newTestIssuer(t).Certificate())
+
+	// A chain of intermediates longer than maxAIADepth.
+	long := intermediate
+	files["/long0"] = der(long.Certificate())
+	for i := 1; i <= maxAIADepth; i++ {
+		_, long = issue(long, fmt.Sprintf("long%d", i), true, fmt.Sprintf("/long%d", i-1))
+		files[fmt.Sprintf("/long%d", i)] = der(long.Certificate())
+	}
+
+	tests := []struct {
+		about   string
+		paths   []string
+		issuer  *Issuer
+		want    []*x509.Certificate
+		wantErr string
+	}{{
+		about:  "DER",
+		paths:  []string{"/intermediate.der"},
+		issuer: intermediate,
+		want:   []*x509.Certificate{intermediate.Certificate(), root.Certificate()},
+	}, {
+		about:  "PEM",
+		paths:  []string{"/intermediate.pem"},
+		issuer: intermediate,
+		want:   []*x509.Certificate{intermediate.Certificate(), root.Certificate()},
+	}, {
+		about:  "fallback URL",
+		paths:  []string{"/missing", "/intermediate.der"},
+		issuer: intermediate,
+		want:   []*x509.Certificate{intermediate.Certificate(), root.Certificate()},
+	}, {
+		about:   "wrong issuer",
+		paths:   []string{"/other.pem"},
+		issuer:  intermediate,
+		wantErr: "is not the issuer",
+	}, {
+		about:   "not found",
+		paths:   []string{"/missing"},
+		issuer:  intermediate,
+		wantErr: "404 Not Found",
+	}, {
+		about:   "too long",
+		paths:   []string{fmt.Sprintf("/long%d", maxAIADepth)},
+		issuer:  long,
+		wantErr: "issuer chain too long",
+	}, {
+		about:  "no URLs",
+		issuer: intermediate,
+	}}
+	for _, test := range tests {
+		t.Run(test.about, func(t *testing.T) {
+			leaf, _ := issue(test.issuer, "leaf", false, test.paths...)
+			chain, err := FetchIssuers(ctx, nil, leaf)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("got error %v, want error containing %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(chain) != len(test.want) {
+				t.Fatalf("got %d certificates, want %d", len(chain), len(test.want))
+			}
+			for i, crt := range chain {
+				if !crt.Equal(test.want[i]) {
+					t.Errorf("certificate %d: got %q, want %q", i, crt.Subject, test.want[i].Subject)
+				}
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/rand"
 	"crypto/sha1"
 	"crypto/x509"
+	"encoding/asn1"
 	"encoding/pem"
 	"io"
 	"math/big"
@@ -121,32 +122,96 @@ func WriteCertificate(w io.Writer, crt *x509.Certificate) error {
 	return WritePEM(w, b)
 }
 
+func ReadCertificatesFile(path string) ([]*x509.Certificate, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot open %s", path)
+	}
+	defer f.Close()
+	crts, err := ReadCertificates(f)
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot read certificates from %s", path)
+	}
+	return crts, nil
+}
+
+// ReadCertificates reads all the certificates from r, in order. Blocks
+// that are not certificates, such as a private key stored in the same
+// file, are skipped. It is an error if there are no certificates.
+func ReadCertificates(r io.Reader) ([]*x509.Certificate, error) {
+	bs, err := ReadPEMBlocks(r)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	var crts []*x509.Certificate
+	for _, b := range bs {
+		if b.Type != "CERTIFICATE" {
+			continue
+		}
+		crt, err := UnmarshalCertificate(b)
+		if err != nil {
+			return nil, errgo.Mask(err)
+		}
+		crts = append(crts, crt)
+	}
+	if len(crts) == 0 {
+		return nil, errgo.New("no certificates found")
+	}
+	return crts, nil
+}
+
+func WriteCertificates(w io.Writer, crts []*x509.Certificate) error {
+	bs := make([]*pem.Block, len(crts))
+	for i, crt := range crts {
+		var err error
+		bs[i], err = MarshalCertificate(crt)
+		if err != nil {
+			return errgo.Mask(err)
+		}
+	}
+	return WritePEMBlocks(w, bs)
+}
+
 func SelfSignCertificate(params *x509.Certificate, key crypto.Signer) (*x509.Certificate, error) {
 	template := *params
-	if err := generateCertificateValues(&template, key.Public()); err != nil {
+	return createCertificate(&template, &template, key.Public(), key)
+}
+
+// createCertificate fills in any generated values in template and then
+// creates the certificate signed by key. Unless the certificate is
+// self-signed its names are checked against the parent's name
+// constraints.
+func createCertificate(template, parent *x509.Certificate, publicKey interface{}, key crypto.Signer) (*x509.Certificate, error) {
+	if parent != template {
+		if err := CheckNameConstraints(parent, template); err != nil {
+			return nil, errgo.Mask(err)
+		}
+	}
+	if err := checkDuplicateExtensions(template.ExtraExtensions); err != nil {
 		return nil, errgo.Mask(err)
 	}
-
-	data, err := x509.CreateCertificate(rand.Reader, &template, &template, key.Public(), key)
+	if err := generateCertificateValues(template, publicKey); err != nil {
+		return nil, errgo.Mask(err)
+	}
+	data, err := x509.CreateCertificate(rand.Reader, template, parent, publicKey, key)
 	if err != nil {
 		return nil, errgo.Mask(err)
 	}
 	crt, err := x509.ParseCertificate(data)
 	if err != nil {
-		// If we can't parse a certificate that we've just created something is very wrong.
-		panic(err)
+		// This can happen if an extra extension has an invalid
+		// value for a standard extension.
+		return nil, errgo.Notef(err, "cannot parse created certificate")
 	}
 	return crt, nil
 }
 
 func generateCertificateValues(template *x509.Certificate, publicKey interface{}) error {
 	if template.SerialNumber == nil {
-		max := big.NewInt(1)
-		max.Lsh(max, 20*8)
 		var err error
-		template.SerialNumber, err = rand.Int(rand.Reader, max)
+		template.SerialNumber, err = generateSerialNumber()
 		if err != nil {
-			return errgo.Notef(err, "cannot generate serial number")
+			return errgo.Mask(err)
 		}
 	}
 	if template.SubjectKeyId == nil {
@@ -156,13 +221,53 @@ func generateCertificateValues(template *x509.Certificate, publicKey interface{}
 			template.SubjectKeyId = sum[:]
 		}
 	}
+	if len(template.Policies) == 0 {
+		// Policies, rather than PolicyIdentifiers, are used when
+		// marshaling certificates.
+		for _, id := range template.PolicyIdentifiers {
+			oid, err := policyOID(id)
+			if err != nil {
+				return errgo.Mask(err)
+			}
+			template.Policies = append(template.Policies, oid)
+		}
+	}
 	return nil
 }
 
-func SignCertificate(csr *x509.CertificateRequest, params, parent *x509.Certificate, key crypto.Signer) (*x509.Certificate, error) {
+func policyOID(id asn1.ObjectIdentifier) (x509.OID, error) {
+	ints := make([]uint64, len(id))
+	for i, n := range id {
+		ints[i] = uint64(n)
+	}
+	oid, err := x509.OIDFromInts(ints)
+	if err != nil {
+		return x509.OID{}, errgo.Notef(err, "invalid policy %s", id)
+	}
+	return oid, nil
+}
+
+// generateSerialNumber generates a random positive serial number of
+// up to 20 octets.
+func generateSerialNumber() (*big.Int, error) {
+	max := big.NewInt(1)
+	max.Lsh(max, 20*8-1)
+	serial, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot generate serial number")
+	}
+	return serial.Add(serial, big.NewInt(1)), nil
+}
+
+// RequestTemplate returns the template that SignCertificate uses to
+// sign a certificate for csr. Any subject or subject alternative names
+// not set in params are taken from csr, and the public key is set to
+// that of csr.
+func RequestTemplate(csr *x509.CertificateRequest, params *x509.Certificate) *x509.Certificate {
 	template := *params
-	if len(template.Subject.ToRDNSequence()) == 0 {
+	if len(template.Subject.ToRDNSequence()) == 0 && len(template.RawSubject) == 0 {
 		template.Subject = csr.Subject
+		template.RawSubject = csr.RawSubject
 	}
 	if len(template.DNSNames) == 0 {
 		template.DNSNames = csr.DNSNames
@@ -173,20 +278,15 @@ func SignCertificate(csr *x509.CertificateRequest, params, parent *x509.Certific
 	if len(template.IPAddresses) == 0 {
 		template.IPAddresses = csr.IPAddresses
 	}
-	if err := generateCertificateValues(&template, csr.PublicKey); err != nil {
-		return nil, errgo.Mask(err)
+	if len(template.URIs) == 0 {
+		template.URIs = csr.URIs
 	}
+	template.PublicKey = csr.PublicKey
+	return &template
+}
 
-	data, err := x509.CreateCertificate(rand.Reader, &template, parent, csr.PublicKey, key)
-	if err != nil {
-		return nil, errgo.Mask(err)
-	}
-	crt, err := x509.ParseCertificate(data)
-	if err != nil {
-		// If we can't parse a certificate that we've just created something is very wrong.
-		panic(err)
-	}
-	return crt, nil
+func SignCertificate(csr *x509.CertificateRequest, params, parent *x509.Certificate, key crypto.Signer) (*x509.Certificate, error) {
+	return createCertificate(RequestTemplate(csr, params), parent, csr.PublicKey, key)
 }
 
 func SignCertificateRequest(template *x509.CertificateRequest, key crypto.Signer) (*x509.CertificateRequest, error) {
@@ -0,0 +1,67 @@
+package ca
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+	"time"
+)
+
+func newTestCertificate(t *testing.T, cn string) *x509.Certificate {
+	key, err := GenerateECDSAKey(elliptic.P256())
+	if err != nil {
+		t.Fatal(err)
+	}
+	crt, err := SelfSignCertificate(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return crt
+}
+
+func TestReadCertificatesSkipsOtherBlocks(t *testing.T) {
+	crt1 := newTestCertificate(t, "one")
+	crt2 := newTestCertificate(t, "two")
+	key, err := GenerateECDSAKey(elliptic.P256())
+	if err != nil {
+		t.Fatal(err)
+	}
+	kb, err := MarshalKey(key, KeyFormatLegacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := WriteCertificate(&buf, crt1); err != nil {
+		t.Fatal(err)
+	}
+	if err := WritePEM(&buf, kb); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteCertificate(&buf, crt2); err != nil {
+		t.Fatal(err)
+	}
+	crts, err := ReadCertificates(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(crts) != 2 || !crts[0].Equal(crt1) || !crts[1].Equal(crt2) {
+		t.Errorf("got %d certificates, want the two written", len(crts))
+	}
+
+	buf.Reset()
+	if err := WritePEM(&buf, kb); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadCertificates(bytes.NewReader(buf.Bytes())); err == nil {
+		t.Errorf("expected error reading file with no certificates")
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/mhilton/ca/acme"
+	"github.com/mhilton/ca/cmd/internal/cmd"
+	"github.com/mhilton/ca/cmd/internal/issuer"
+	"github.com/mhilton/ca/cmd/internal/profile"
+)
+
+var (
+	addr        = flag.String("addr", ":8443", "`address` on which to serve ACME requests.")
+	baseURL     = flag.String("base-url", "", "external `URL` of the ACME server, the directory is at URL/directory. (required)")
+	profileName = flag.String("profile", "server", "certificate `profile`, either a built-in profile or a profile file.")
+	httpPort    = flag.Int("http-port", 80, "`port` on which http-01 challenges are validated.")
+	dnsServer   = flag.String("dns-server", "", "`address` of the DNS server used to validate dns-01 challenges. (default system resolver)")
+	tlsCert     = flag.String("tls-cert", "", "`file` containing the TLS certificate for the server.")
+	tlsKey      = flag.String("tls-key", "", "`file` containing the TLS key for the server.")
+)
+
+func main() {
+	flag.Usage = cmd.Usage("usage: %s -cert file -key file -base-url url [options]", os.Args[0])
+	flag.Parse()
+	if *baseURL == "" {
+		cmd.Usagef("no base URL specified.")
+	}
+	if (*tlsCert == "") != (*tlsKey == "") {
+		cmd.Usagef("-tls-cert and -tls-key must be specified together.")
+	}
+	ctx := context.Background()
+
+	iss, err := issuer.Load(ctx)
+	if err != nil {
+		cmd.Fatalf(err, "cannot load issuer")
+	}
+	p, err := profile.Load(*profileName)
+	if err != nil {
+		cmd.Fatalf(err, "cannot load profile")
+	}
+	params := acme.Params{
+		Issuer:   iss,
+		Profile:  p,
+		BaseURL:  *baseURL,
+		HTTPPort: *httpPort,
+	}
+	if *dnsServer != "" {
+		params.Resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, *dnsServer)
+			},
+		}
+	}
+	srv, err := acme.New(params)
+	if err != nil {
+		cmd.Fatalf(err, "cannot create ACME server")
+	}
+	hs := &http.Server{
+		Addr:              *addr,
+		Handler:           srv,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	if *tlsCert != "" {
+		err = hs.ListenAndServeTLS(*tlsCert, *tlsKey)
+	} else {
+		err = hs.ListenAndServe()
+	}
+	if err != nil {
+		cmd.Fatalf(err, "cannot serve")
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"flag"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/mhilton/ca"
+	"github.com/mhilton/ca/cmd/internal/cmd"
+	"github.com/mhilton/ca/cmd/internal/outform"
+)
+
+var (
+	timeout = flag.Duration("timeout", 30*time.Second, "`duration` after which fetching an issuer is abandoned.")
+)
+
+func main() {
+	flag.Usage = cmd.Usage("usage: %s [options] certificate-file", os.Args[0])
+	flag.Parse()
+	if flag.NArg() != 1 {
+		cmd.Usagef("a single certificate file must be specified.")
+	}
+	crt, err := ca.ReadCertificateFile(flag.Arg(0))
+	if err != nil {
+		cmd.Fatalf(err, "cannot load certificate")
+	}
+	client := &http.Client{
+		Timeout: *timeout,
+	}
+	chain, err := ca.FetchIssuers(context.Background(), client, crt)
+	if err != nil {
+		cmd.Fatalf(err, "cannot complete chain")
+	}
+	if err := outform.WriteCertificates(os.Stdout, append([]*x509.Certificate{crt}, chain...)); err != nil {
+		cmd.Fatalf(err, "cannot write certificates")
+	}
+}
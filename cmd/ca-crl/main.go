@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"flag"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	errgo "gopkg.in/errgo.v1"
+
+	"github.com/mhilton/ca"
+	"github.com/mhilton/ca/cmd/internal/bigint"
+	"github.com/mhilton/ca/cmd/internal/cmd"
+	"github.com/mhilton/ca/cmd/internal/outform"
+	"github.com/mhilton/ca/cmd/internal/passphrase"
+	"github.com/mhilton/ca/cmd/internal/store"
+)
+
+var (
+	crtFile = flag.String("cert", "", "`file` containing the signing certificate. (required)")
+	keyFile = flag.String("key", "", "`file` containing the signing key. (required)")
+	crlFile = flag.String("crl", "", "`file` containing a previous CRL whose entries are included in the new CRL.")
+	days    = flag.Int("days", 7, "Number of `days` until the next CRL update.")
+	number  bigint.Var
+	revoked revokedVar
+)
+
+func init() {
+	flag.Var(&number, "number", "CRL `number`. (default allocated by the certificate store, or one more than the previous CRL)")
+	flag.Var(&revoked, "revoke", "revoke the certificate described by `serial[,reason[,time]]`. The time is in RFC 3339 format and defaults to now.")
+}
+
+func main() {
+	flag.Usage = cmd.Usage("usage: %s -cert file -key file [options]", os.Args[0])
+	flag.Parse()
+	if *crtFile == "" {
+		cmd.Usagef("no certificate file specified.")
+	}
+	if *keyFile == "" {
+		cmd.Usagef("no key file specified.")
+	}
+
+	ctx := context.Background()
+	crt, err := ca.ReadCertificateFile(*crtFile)
+	if err != nil {
+		cmd.Fatalf(err, "cannot load signing certificate")
+	}
+	key, err := ca.ReadKeyFile(ctx, *keyFile, passphrase.Getter())
+	if err != nil {
+		cmd.Fatalf(err, "cannot load signing key")
+	}
+	issuer, err := ca.NewIssuer(crt, key)
+	if err != nil {
+		cmd.Fatalf(err, "invalid signing certificate")
+	}
+
+	now := time.Now()
+	template := x509.RevocationList{
+		Number:     number.N,
+		ThisUpdate: now,
+		NextUpdate: now.Add(time.Duration(*days) * 24 * time.Hour),
+	}
+	// Entries given on the command line take precedence over those
+	// in the store, which take precedence over those in the previous
+	// CRL.
+	for _, e := range revoked {
+		if e.RevocationTime.IsZero() {
+			e.RevocationTime = now
+		}
+		template.RevokedCertificateEntries = ca.MergeRevocationEntries(template.RevokedCertificateEntries, e)
+	}
+	db, err := store.Open()
+	if err != nil {
+		cmd.Fatalf(err, "cannot open certificate store")
+	}
+	if db != nil {
+		issuer.SetStore(db)
+		entries, err := ca.RevokedEntries(ctx, db, crt)
+		if err != nil {
+			cmd.Fatalf(err, "cannot read certificate store")
+		}
+		template.RevokedCertificateEntries = ca.MergeRevocationEntries(template.RevokedCertificateEntries, entries...)
+	}
+	var prevNumber *big.Int
+	if *crlFile != "" {
+		prev, err := ca.ReadCRLFile(*crlFile)
+		if err != nil {
+			cmd.Fatalf(err, "cannot load CRL")
+		}
+		if err := prev.CheckSignatureFrom(crt); err != nil {
+			cmd.Fatalf(err, "CRL not issued by signing certificate")
+		}
+		template.RevokedCertificateEntries = ca.MergeRevocationEntries(template.RevokedCertificateEntries, prev.RevokedCertificateEntries...)
+		prevNumber = prev.Number
+	}
+	if template.Number == nil {
+		switch db := db.(type) {
+		case ca.CRLNumberStore:
+			// Allocate from the store even when there is a previous
+			// CRL so that numbers are never reused, making sure the
+			// store moves past the previous CRL's number.
+			template.Number, err = db.NextCRLNumber(ctx, crt, prevNumber)
+			if err != nil {
+				cmd.Fatalf(err, "cannot allocate CRL number")
+			}
+		case nil:
+			if prevNumber == nil {
+				cmd.Usagef("no CRL number: specify -number, -crl or -db.")
+			}
+			template.Number = new(big.Int).Add(prevNumber, big.NewInt(1))
+		default:
+			cmd.Usagef("certificate store cannot allocate CRL numbers: specify -number.")
+		}
+	}
+	crl, err := issuer.CreateCRL(ctx, &template)
+	if err != nil {
+		cmd.Fatalf(err, "cannot create CRL")
+	}
+	b, err := ca.MarshalCRL(crl)
+	if err != nil {
+		cmd.Fatalf(err, "cannot write CRL")
+	}
+	if err := outform.Write(os.Stdout, b); err != nil {
+		cmd.Fatalf(err, "cannot write CRL")
+	}
+}
+
+type revokedVar []x509.RevocationListEntry
+
+func (v *revokedVar) Set(s string) error {
+	parts := strings.Split(s, ",")
+	if len(parts) > 3 {
+		return errgo.Newf("invalid revocation %q", s)
+	}
+	var e x509.RevocationListEntry
+	var ok bool
+	e.SerialNumber, ok = new(big.Int).SetString(parts[0], 0)
+	if !ok {
+		return errgo.Newf("invalid serial number %q", parts[0])
+	}
+	if len(parts) > 1 {
+		var err error
+		e.ReasonCode, err = ca.ParseRevocationReason(parts[1])
+		if err != nil {
+			return errgo.Mask(err)
+		}
+	}
+	if len(parts) > 2 {
+		var err error
+		e.RevocationTime, err = time.Parse(time.RFC3339, parts[2])
+		if err != nil {
+			return errgo.Notef(err, "cannot parse revocation time")
+		}
+	}
+	*v = append(*v, e)
+	return nil
+}
+
+func (v revokedVar) String() string {
+	ss := make([]string, len(v))
+	for i, e := range v {
+		ss[i] = "0x" + e.SerialNumber.Text(16)
+	}
+	return strings.Join(ss, " ")
+}
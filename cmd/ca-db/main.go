@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	errgo "gopkg.in/errgo.v1"
+
+	"github.com/mhilton/ca"
+	"github.com/mhilton/ca/cmd/internal/bigint"
+	"github.com/mhilton/ca/cmd/internal/cmd"
+	"github.com/mhilton/ca/cmd/internal/outform"
+	"github.com/mhilton/ca/cmd/internal/store"
+)
+
+var (
+	outputPEM     = flag.Bool("pem", false, "write the matching certificates, in the format specified with -outform, rather than a summary.")
+	san           = flag.String("san", "", "only match certificates with the subject alternative `name`.")
+	subject       = flag.String("subject", "", "only match certificates with the subject common name or distinguished `name`.")
+	expiresAfter  timeVar
+	expiresBefore timeVar
+	revoke        reasonVar
+	serialNumber  bigint.Var
+)
+
+func init() {
+	flag.Var(&expiresAfter, "expires-after", "only match certificates that expire after `time`.")
+	flag.Var(&expiresBefore, "expires-before", "only match certificates that expire before `time`.")
+	flag.Var(&revoke, "revoke", "revoke the matching certificates with the given `reason`.")
+	flag.Var(&serialNumber, "serial", "only match the certificate with the given serial `number`.")
+}
+
+func main() {
+	flag.Usage = cmd.Usage("usage: %s -db directory [options]", os.Args[0])
+	flag.Parse()
+	ctx := context.Background()
+
+	db, err := store.Open()
+	if err != nil {
+		cmd.Fatalf(err, "cannot open certificate store")
+	}
+	if db == nil {
+		cmd.Usagef("no certificate store specified.")
+	}
+	q := ca.Query{
+		Subject:       *subject,
+		SAN:           *san,
+		ExpiresBefore: time.Time(expiresBefore),
+		ExpiresAfter:  time.Time(expiresAfter),
+	}
+	if revoke.set && q == (ca.Query{}) && serialNumber.N == nil {
+		cmd.Usagef("refusing to revoke every certificate.")
+	}
+	var records []*ca.Record
+	if serialNumber.N != nil {
+		r, err := db.Get(ctx, serialNumber.N)
+		if err != nil {
+			cmd.Fatalf(err, "cannot get certificate")
+		}
+		if q.Match(r.Certificate) {
+			records = append(records, r)
+		}
+	} else {
+		records, err = db.Find(ctx, q)
+		if err != nil {
+			cmd.Fatalf(err, "cannot find certificates")
+		}
+	}
+	now := time.Now()
+	for _, r := range records {
+		if revoke.set && !r.Revoked {
+			err := db.Revoke(ctx, r.Certificate.SerialNumber, now, revoke.reason)
+			if err != nil && errgo.Cause(err) != ca.ErrRevoked {
+				cmd.Fatalf(err, "cannot revoke certificate")
+			}
+			r.Revoked = true
+		}
+		if *outputPEM {
+			if err := outform.WriteCertificates(os.Stdout, []*x509.Certificate{r.Certificate}); err != nil {
+				cmd.Fatalf(err, "cannot write certificate")
+			}
+			continue
+		}
+		fmt.Printf("0x%X\t%s\t%s\t%s\n", r.Certificate.SerialNumber, r.Certificate.NotAfter.Format(time.RFC3339), status(r, now), r.Certificate.Subject)
+	}
+}
+
+func status(r *ca.Record, now time.Time) string {
+	switch {
+	case r.Revoked:
+		return "revoked"
+	case now.After(r.Certificate.NotAfter):
+		return "expired"
+	default:
+		return "valid"
+	}
+}
+
+type timeVar time.Time
+
+func (v *timeVar) Set(s string) error {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return errgo.Notef(err, "cannot parse")
+	}
+	*v = timeVar(t)
+	return nil
+}
+
+func (v timeVar) String() string {
+	if time.Time(v).IsZero() {
+		return ""
+	}
+	return time.Time(v).Format(time.RFC3339)
+}
+
+type reasonVar struct {
+	set    bool
+	name   string
+	reason int
+}
+
+func (v *reasonVar) Set(s string) error {
+	r, err := ca.ParseRevocationReason(s)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	*v = reasonVar{set: true, name: s, reason: r}
+	return nil
+}
+
+func (v reasonVar) String() string {
+	return v.name
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"os"
+	"time"
+
+	errgo "gopkg.in/errgo.v1"
+
+	"github.com/mhilton/ca"
+	"github.com/mhilton/ca/cmd/internal/cmd"
+	"github.com/mhilton/ca/cmd/internal/issuer"
+	"github.com/mhilton/ca/cmd/internal/profile"
+	"github.com/mhilton/ca/cmd/internal/store"
+	"github.com/mhilton/ca/est"
+)
+
+var (
+	addr        = flag.String("addr", ":8443", "`address` on which to serve EST requests.")
+	profileName = flag.String("profile", "server", "certificate `profile`, either a built-in profile or a profile file.")
+	usersFile   = flag.String("users", "", "`file` containing a JSON object mapping usernames to passwords for HTTP basic authentication.")
+	tlsCert     = flag.String("tls-cert", "", "`file` containing the TLS certificate for the server. (required)")
+	tlsKey      = flag.String("tls-key", "", "`file` containing the TLS key for the server. (required)")
+	clientCA    = flag.String("client-ca", "", "`file` containing the CA certificates used to verify TLS client certificates. Clients authenticated only by a certificate may enroll only for its names. (default the signing certificate)")
+)
+
+func main() {
+	flag.Usage = cmd.Usage("usage: %s -cert file -key file -tls-cert file -tls-key file [options]", os.Args[0])
+	flag.Parse()
+	if *tlsCert == "" || *tlsKey == "" {
+		cmd.Usagef("-tls-cert and -tls-key must be specified.")
+	}
+	ctx := context.Background()
+
+	iss, err := issuer.Load(ctx)
+	if err != nil {
+		cmd.Fatalf(err, "cannot load issuer")
+	}
+	p, err := profile.Load(*profileName)
+	if err != nil {
+		cmd.Fatalf(err, "cannot load profile")
+	}
+	db, err := store.Open()
+	if err != nil {
+		cmd.Fatalf(err, "cannot open certificate store")
+	}
+	params := est.Params{
+		Issuer:  iss,
+		Profile: p,
+		Store:   db,
+	}
+	if *usersFile != "" {
+		params.Users, err = readUsers(*usersFile)
+		if err != nil {
+			cmd.Fatalf(err, "cannot load users")
+		}
+	}
+	srv, err := est.New(params)
+	if err != nil {
+		cmd.Fatalf(err, "cannot create EST server")
+	}
+	pool := x509.NewCertPool()
+	if *clientCA != "" {
+		crts, err := ca.ReadCertificatesFile(*clientCA)
+		if err != nil {
+			cmd.Fatalf(err, "cannot load client CA certificates")
+		}
+		for _, crt := range crts {
+			pool.AddCert(crt)
+		}
+	} else {
+		pool.AddCert(iss.Certificate())
+	}
+	hs := &http.Server{
+		Addr:              *addr,
+		Handler:           srv,
+		ReadHeaderTimeout: 10 * time.Second,
+		TLSConfig: &tls.Config{
+			ClientAuth: tls.VerifyClientCertIfGiven,
+			ClientCAs:  pool,
+		},
+	}
+	if err := hs.ListenAndServeTLS(*tlsCert, *tlsKey); err != nil {
+		cmd.Fatalf(err, "cannot serve")
+	}
+}
+
+func readUsers(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot open %s", path)
+	}
+	defer f.Close()
+	var users map[string]string
+	if err := json.NewDecoder(f).Decode(&users); err != nil {
+		return nil, errgo.Notef(err, "cannot read users from %s", path)
+	}
+	return users, nil
+}
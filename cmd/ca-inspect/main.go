@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"os"
+
+	errgo "gopkg.in/errgo.v1"
+
+	"github.com/mhilton/ca"
+	"github.com/mhilton/ca/cmd/internal/cmd"
+	"github.com/mhilton/ca/cmd/internal/passphrase"
+)
+
+var (
+	decrypt  = flag.Bool("decrypt", false, "decrypt encrypted private keys in order to describe them.")
+	jsonFlag = flag.Bool("json", false, "write the descriptions as a JSON array.")
+)
+
+func main() {
+	flag.Usage = cmd.Usage("usage: %s [options] [file...]", os.Args[0])
+	flag.Parse()
+	ctx := context.Background()
+
+	var ds []*ca.Description
+	if flag.NArg() == 0 {
+		var err error
+		ds, err = describe(ctx, os.Stdin)
+		if err != nil {
+			cmd.Fatalf(err, "cannot read standard input")
+		}
+	}
+	for _, path := range flag.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			cmd.Fatalf(err, "cannot open %s", path)
+		}
+		fds, err := describe(ctx, f)
+		f.Close()
+		if err != nil {
+			cmd.Fatalf(err, "cannot read %s", path)
+		}
+		ds = append(ds, fds...)
+	}
+	if *jsonFlag {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		if err := enc.Encode(ds); err != nil {
+			cmd.Fatalf(err, "cannot write descriptions")
+		}
+		return
+	}
+	for i, d := range ds {
+		if i > 0 {
+			os.Stdout.WriteString("\n")
+		}
+		if err := d.WriteText(os.Stdout); err != nil {
+			cmd.Fatalf(err, "cannot write descriptions")
+		}
+	}
+}
+
+func describe(ctx context.Context, r io.Reader) ([]*ca.Description, error) {
+	bs, err := ca.ReadPEMBlocks(r)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	ds := make([]*ca.Description, len(bs))
+	for i, b := range bs {
+		if *decrypt {
+			b, err = ca.DecryptPEMBlock(ctx, b, passphrase.Getter())
+			if err != nil {
+				return nil, errgo.Mask(err)
+			}
+		}
+		ds[i], err = ca.Describe(b)
+		if err != nil {
+			return nil, errgo.Mask(err)
+		}
+	}
+	return ds, nil
+}
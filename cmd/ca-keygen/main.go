@@ -12,20 +12,25 @@ import (
 
 	"github.com/mhilton/ca"
 	"github.com/mhilton/ca/cmd/internal/cmd"
+	"github.com/mhilton/ca/cmd/internal/outform"
 	"github.com/mhilton/ca/cmd/internal/passphrase"
 )
 
 var (
 	bits    = flag.Int("bits", 2048, "`size` of key, for RSA.")
-	cipher  = cipherVar("aes128")
+	cipher  = cipherVar("pbes2-aes256")
 	curve   = curveVar("p256")
+	format  = formatVar("legacy")
+	kdf     = kdfVar("pbkdf2")
 	keyType = keyTypeVar("rsa")
 )
 
 func init() {
 	flag.Var(&cipher, "cipher", "`cipher` to use to encode the generated key.")
 	flag.Var(&curve, "curve", "name of the `curve`, for ECDSA.")
-	flag.Var(&keyType, "type", "`type` of key (rsa or ecdsa).")
+	flag.Var(&format, "format", "`format` of the generated key (legacy or pkcs8).")
+	flag.Var(&kdf, "kdf", "key derivation `function` for pbes2 ciphers (pbkdf2 or scrypt).")
+	flag.Var(&keyType, "type", "`type` of key (rsa, ecdsa or ed25519).")
 }
 
 func main() {
@@ -36,7 +41,15 @@ func main() {
 	if err != nil {
 		cmd.Fatalf(err, "error generating key")
 	}
-	if err = ca.WriteKey(context.Background(), os.Stdout, key, passphrase.Getter(), cipher.cipher()); err != nil {
+	b, err := ca.MarshalKey(key, format.format())
+	if err != nil {
+		cmd.Fatalf(err, "error writing key")
+	}
+	b, err = ca.EncryptPEMBlock(context.Background(), b, passphrase.Getter(), cipher.cipher())
+	if err != nil {
+		cmd.Fatalf(err, "error writing key")
+	}
+	if err = outform.Write(os.Stdout, b); err != nil {
 		cmd.Fatalf(err, "error writing key")
 	}
 }
@@ -75,6 +88,9 @@ var keyTypes = map[string]func() (crypto.Signer, error){
 	"ecdsa": func() (crypto.Signer, error) {
 		return ca.GenerateECDSAKey(curve.curve())
 	},
+	"ed25519": func() (crypto.Signer, error) {
+		return ca.GenerateEd25519Key()
+	},
 }
 
 func (v *keyTypeVar) Set(s string) error {
@@ -95,13 +111,19 @@ func (v keyTypeVar) generate() (crypto.Signer, error) {
 
 type cipherVar string
 
-var ciphers = map[string]x509.PEMCipher{
-	"":       0,
-	"des":    x509.PEMCipherDES,
-	"3des":   x509.PEMCipher3DES,
-	"aes128": x509.PEMCipherAES128,
-	"aes192": x509.PEMCipherAES192,
-	"aes256": x509.PEMCipherAES192,
+var ciphers = map[string]ca.KeyCipher{
+	"":                 nil,
+	"des":              ca.LegacyCipher(x509.PEMCipherDES),
+	"3des":             ca.LegacyCipher(x509.PEMCipher3DES),
+	"aes128":           ca.LegacyCipher(x509.PEMCipherAES128),
+	"aes192":           ca.LegacyCipher(x509.PEMCipherAES192),
+	"aes256":           ca.LegacyCipher(x509.PEMCipherAES256),
+	"pbes2-aes128":     ca.PBES2Cipher{Cipher: ca.AES128CBC},
+	"pbes2-aes192":     ca.PBES2Cipher{Cipher: ca.AES192CBC},
+	"pbes2-aes256":     ca.PBES2Cipher{Cipher: ca.AES256CBC},
+	"pbes2-aes128-gcm": ca.PBES2Cipher{Cipher: ca.AES128GCM},
+	"pbes2-aes192-gcm": ca.PBES2Cipher{Cipher: ca.AES192GCM},
+	"pbes2-aes256-gcm": ca.PBES2Cipher{Cipher: ca.AES256GCM},
 }
 
 func (v *cipherVar) Set(s string) error {
@@ -116,6 +138,57 @@ func (v cipherVar) String() string {
 	return string(v)
 }
 
-func (v cipherVar) cipher() x509.PEMCipher {
-	return ciphers[string(v)]
+func (v cipherVar) cipher() ca.KeyCipher {
+	c := ciphers[string(v)]
+	if pc, ok := c.(ca.PBES2Cipher); ok {
+		pc.KDF = kdf.kdf()
+		return pc
+	}
+	return c
+}
+
+type kdfVar string
+
+var kdfs = map[string]ca.PBES2KDF{
+	"pbkdf2": ca.PBKDF2,
+	"scrypt": ca.Scrypt,
+}
+
+func (v *kdfVar) Set(s string) error {
+	if _, ok := kdfs[s]; ok {
+		*v = kdfVar(s)
+		return nil
+	}
+	return errgo.Newf("unsupported key derivation function %q", s)
+}
+
+func (v kdfVar) String() string {
+	return string(v)
+}
+
+func (v kdfVar) kdf() ca.PBES2KDF {
+	return kdfs[string(v)]
+}
+
+type formatVar string
+
+var formats = map[string]ca.KeyFormat{
+	"legacy": ca.KeyFormatLegacy,
+	"pkcs8":  ca.KeyFormatPKCS8,
+}
+
+func (v *formatVar) Set(s string) error {
+	if _, ok := formats[s]; ok {
+		*v = formatVar(s)
+		return nil
+	}
+	return errgo.Newf("unsupported key format %q", s)
+}
+
+func (v formatVar) String() string {
+	return string(v)
+}
+
+func (v formatVar) format() ca.KeyFormat {
+	return formats[string(v)]
 }
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/mhilton/ca"
+	"github.com/mhilton/ca/cmd/internal/cmd"
+	"github.com/mhilton/ca/lint"
+)
+
+var (
+	maxDays    = flag.Int("max-days", int(lint.DefaultMaxValidity/(24*time.Hour)), "maximum number of `days` for which an end-entity certificate may be valid.")
+	minRSABits = flag.Int("min-rsa-bits", lint.DefaultMinRSABits, "minimum `size` of an RSA key.")
+	strict     = flag.Bool("strict", false, "treat warnings as errors.")
+)
+
+func main() {
+	flag.Usage = cmd.Usage("usage: %s [options] [file...]", os.Args[0])
+	flag.Parse()
+	opts := &lint.Options{
+		MaxValidity: time.Duration(*maxDays) * 24 * time.Hour,
+		MinRSABits:  *minRSABits,
+	}
+
+	failed := false
+	check := func(name string, crts []*x509.Certificate) {
+		for _, crt := range crts {
+			for _, p := range lint.Check(crt, opts) {
+				fmt.Printf("%s: %s: %s\n", name, crt.Subject, p)
+				if p.Severity == lint.Error || *strict {
+					failed = true
+				}
+			}
+		}
+	}
+	if flag.NArg() == 0 {
+		crts, err := ca.ReadCertificates(os.Stdin)
+		if err != nil {
+			cmd.Fatalf(err, "cannot read standard input")
+		}
+		check("-", crts)
+	}
+	for _, path := range flag.Args() {
+		crts, err := ca.ReadCertificatesFile(path)
+		if err != nil {
+			cmd.Fatalf(err, "cannot load certificates")
+		}
+		check(path, crts)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
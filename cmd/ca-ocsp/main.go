@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/mhilton/ca"
+	"github.com/mhilton/ca/cmd/internal/cmd"
+	"github.com/mhilton/ca/cmd/internal/passphrase"
+	"github.com/mhilton/ca/cmd/internal/store"
+	"github.com/mhilton/ca/ocsp"
+)
+
+var (
+	addr          = flag.String("addr", ":8080", "`address` on which to serve OCSP requests.")
+	crtFile       = flag.String("cert", "", "`file` containing the CA certificate. (required)")
+	keyFile       = flag.String("key", "", "`file` containing the signing key, either the CA key or the key for -responder-cert. (required)")
+	responderFile = flag.String("responder-cert", "", "`file` containing a delegated OCSP signing certificate.")
+	validity      = flag.Duration("validity", 24*time.Hour, "`duration` for which responses are valid.")
+	refresh       = flag.Duration("refresh", 0, "`interval` at which responses are precomputed. (default a quarter of -validity)")
+)
+
+func main() {
+	flag.Usage = cmd.Usage("usage: %s -cert file -key file -db directory [options]", os.Args[0])
+	flag.Parse()
+	if *crtFile == "" {
+		cmd.Usagef("no certificate file specified.")
+	}
+	if *keyFile == "" {
+		cmd.Usagef("no key file specified.")
+	}
+	ctx := context.Background()
+
+	db, err := store.Open()
+	if err != nil {
+		cmd.Fatalf(err, "cannot open certificate store")
+	}
+	if db == nil {
+		cmd.Usagef("no certificate store specified.")
+	}
+	issuer, err := ca.ReadCertificateFile(*crtFile)
+	if err != nil {
+		cmd.Fatalf(err, "cannot load CA certificate")
+	}
+	key, err := ca.ReadKeyFile(ctx, *keyFile, passphrase.Getter())
+	if err != nil {
+		cmd.Fatalf(err, "cannot load signing key")
+	}
+	p := ocsp.Params{
+		Issuer:        issuer,
+		Key:           key,
+		Store:         db,
+		Validity:      *validity,
+		CacheDuration: *refresh,
+	}
+	if *responderFile != "" {
+		p.Responder, err = ca.ReadCertificateFile(*responderFile)
+		if err != nil {
+			cmd.Fatalf(err, "cannot load responder certificate")
+		}
+	}
+	if p.CacheDuration == 0 {
+		p.CacheDuration = p.Validity / 4
+	}
+	responder, err := ocsp.New(p)
+	if err != nil {
+		cmd.Fatalf(err, "cannot create OCSP responder")
+	}
+	if err := responder.Precompute(ctx); err != nil {
+		cmd.Fatalf(err, "cannot precompute responses")
+	}
+	go func() {
+		for range time.Tick(p.CacheDuration) {
+			if err := responder.Precompute(ctx); err != nil {
+				log.Printf("cannot precompute responses: %s", err)
+			}
+		}
+	}()
+	if err := http.ListenAndServe(*addr, responder); err != nil {
+		cmd.Fatalf(err, "cannot serve")
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"flag"
+	"os"
+
+	"github.com/mhilton/ca"
+	"github.com/mhilton/ca/cmd/internal/cmd"
+	"github.com/mhilton/ca/cmd/internal/outform"
+	"github.com/mhilton/ca/cmd/internal/passphrase"
+)
+
+var (
+	inFile  = flag.String("in", "", "`file` containing PKCS#12 data to convert to PEM.")
+	crtFile = flag.String("cert", "", "`file` containing the certificate, optionally followed by its chain, to convert to PKCS#12.")
+	keyFile = flag.String("key", "", "`file` containing the key to convert to PKCS#12.")
+)
+
+func main() {
+	flag.Usage = cmd.Usage("usage: %s -cert file -key file [options]\n       %s -in file [options]", os.Args[0], os.Args[0])
+	flag.Parse()
+	ctx := context.Background()
+	switch {
+	case *inFile != "" && (*crtFile != "" || *keyFile != ""):
+		cmd.Usagef("-in cannot be used with -cert or -key.")
+	case *inFile != "" && outform.DER():
+		cmd.Usagef("-outform der cannot be used with -in as the output contains more than one object.")
+	case *inFile != "":
+		fromPKCS12(ctx)
+	case *crtFile == "":
+		cmd.Usagef("no certificate file specified.")
+	case *keyFile == "":
+		cmd.Usagef("no key file specified.")
+	default:
+		toPKCS12(ctx)
+	}
+}
+
+// fromPKCS12 writes the key and certificates in the PKCS#12 file as
+// PEM. The key is written in PKCS#8 format encrypted with the same
+// passphrase as the PKCS#12 file, so the passphrase is only asked for
+// once.
+func fromPKCS12(ctx context.Context) {
+	pg := passphrase.Reuse(passphrase.Getter())
+	key, crt, chain, err := ca.ReadPKCS12File(ctx, *inFile, pg)
+	if err != nil {
+		cmd.Fatalf(err, "cannot load PKCS#12 file")
+	}
+	alg := ca.PBES2Cipher{
+		Cipher: ca.AES256CBC,
+		KDF:    ca.PBKDF2,
+	}
+	b, err := ca.MarshalKey(key, ca.KeyFormatPKCS8)
+	if err != nil {
+		cmd.Fatalf(err, "cannot write key")
+	}
+	b, err = ca.EncryptPEMBlock(ctx, b, pg, alg)
+	if err != nil {
+		cmd.Fatalf(err, "cannot write key")
+	}
+	if err := outform.Write(os.Stdout, b); err != nil {
+		cmd.Fatalf(err, "cannot write key")
+	}
+	if err := outform.WriteCertificates(os.Stdout, append([]*x509.Certificate{crt}, chain...)); err != nil {
+		cmd.Fatalf(err, "cannot write certificates")
+	}
+}
+
+// toPKCS12 writes the key and certificates as a PKCS#12 file. If the
+// key is encrypted the PKCS#12 file is encrypted with the same
+// passphrase, so the passphrase is only asked for once.
+func toPKCS12(ctx context.Context) {
+	pg := passphrase.Reuse(passphrase.Getter())
+	crts, err := ca.ReadCertificatesFile(*crtFile)
+	if err != nil {
+		cmd.Fatalf(err, "cannot load certificate")
+	}
+	key, err := ca.ReadKeyFile(ctx, *keyFile, pg)
+	if err != nil {
+		cmd.Fatalf(err, "cannot load key")
+	}
+	if err := ca.WritePKCS12(ctx, os.Stdout, key, crts[0], crts[1:], pg); err != nil {
+		cmd.Fatalf(err, "cannot write PKCS#12 file")
+	}
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/mhilton/ca"
 	"github.com/mhilton/ca/cmd/internal/cmd"
+	"github.com/mhilton/ca/cmd/internal/outform"
 	"github.com/mhilton/ca/cmd/internal/passphrase"
 	"github.com/mhilton/ca/cmd/internal/subject"
 )
@@ -29,15 +30,24 @@ func main() {
 	}
 	template := &x509.CertificateRequest{
 		Subject:        subject.Subject(),
+		RawSubject:     subject.RawSubject(),
 		DNSNames:       subject.DNSNames(),
 		EmailAddresses: subject.EmailAddresses(),
 		IPAddresses:    subject.IPAddresses(),
+		URIs:           subject.URIs(),
+	}
+	if err := subject.CheckURIs(template.URIs); err != nil {
+		cmd.Fatalf(err, "invalid URI")
 	}
 	csr, err := ca.SignCertificateRequest(template, key)
 	if err != nil {
 		cmd.Fatalf(err, "cannot create certificate request")
 	}
-	if err := ca.WriteCertificateRequest(os.Stdout, csr); err != nil {
+	b, err := ca.MarshalCertificateRequest(csr)
+	if err != nil {
+		cmd.Fatalf(err, "cannot write certificate request")
+	}
+	if err := outform.Write(os.Stdout, b); err != nil {
 		cmd.Fatalf(err, "cannot write certificate request")
 	}
 }
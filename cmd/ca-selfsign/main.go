@@ -8,8 +8,11 @@ import (
 
 	"github.com/mhilton/ca"
 	"github.com/mhilton/ca/cmd/internal/cmd"
+	"github.com/mhilton/ca/cmd/internal/lint"
+	"github.com/mhilton/ca/cmd/internal/outform"
 	"github.com/mhilton/ca/cmd/internal/params"
 	"github.com/mhilton/ca/cmd/internal/passphrase"
+	"github.com/mhilton/ca/cmd/internal/store"
 	"github.com/mhilton/ca/cmd/internal/subject"
 )
 
@@ -20,26 +23,40 @@ var (
 func main() {
 	flag.Usage = cmd.Usage("usage: %s -key file [options]", os.Args[0])
 	flag.Parse()
+	ctx := context.Background()
 
 	if *keyFile == "" {
 		cmd.Usagef("key file required.")
 	}
-	key, err := ca.ReadKeyFile(context.Background(), *keyFile, passphrase.Getter())
+	key, err := ca.ReadKeyFile(ctx, *keyFile, passphrase.Getter())
 	if err != nil {
 		cmd.Fatalf(err, "cannot read key")
 	}
 	template := x509.Certificate{
 		Subject:        subject.Subject(),
+		RawSubject:     subject.RawSubject(),
 		DNSNames:       subject.DNSNames(),
 		EmailAddresses: subject.EmailAddresses(),
 		IPAddresses:    subject.IPAddresses(),
+		URIs:           subject.URIs(),
+	}
+	if err := subject.CheckURIs(template.URIs); err != nil {
+		cmd.Fatalf(err, "invalid URI")
 	}
 	params.SetParams(&template)
-	crt, err := ca.SelfSignCertificate(&template, key)
+	db, err := store.Open()
+	if err != nil {
+		cmd.Fatalf(err, "cannot open certificate store")
+	}
+	template.PublicKey = key.Public()
+	if err := lint.Check(&template, key.Public()); err != nil {
+		cmd.Fatalf(err, "cannot create certificate")
+	}
+	crt, err := ca.SelfSignCertificateWithStore(ctx, db, &template, key)
 	if err != nil {
 		cmd.Fatalf(err, "cannot create certificate")
 	}
-	if err := ca.WriteCertificate(os.Stdout, crt); err != nil {
+	if err := outform.WriteCertificates(os.Stdout, []*x509.Certificate{crt}); err != nil {
 		cmd.Fatalf(err, "cannot write certificate")
 	}
 }
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	errgo "gopkg.in/errgo.v1"
+
+	"github.com/mhilton/ca"
+	"github.com/mhilton/ca/cmd/internal/cmd"
+	"github.com/mhilton/ca/cmd/internal/issuer"
+	"github.com/mhilton/ca/cmd/internal/profile"
+	"github.com/mhilton/ca/cmd/internal/store"
+	"github.com/mhilton/ca/server"
+)
+
+var (
+	addr        = flag.String("addr", ":8443", "`address` on which to serve requests.")
+	configFile  = flag.String("config", "", "`file` containing the server configuration. (required)")
+	crlValidity = flag.Duration("crl-validity", 24*time.Hour, "`duration` for which served CRLs are valid.")
+	tlsCert     = flag.String("tls-cert", "", "`file` containing the TLS certificate for the server.")
+	tlsKey      = flag.String("tls-key", "", "`file` containing the TLS key for the server.")
+	clientCA    = flag.String("client-ca", "", "`file` containing the CA certificates used to verify TLS client certificates. (requires -tls-cert)")
+)
+
+// config is the format of the configuration file.
+type config struct {
+	// Callers holds the callers allowed to use the server. Caller
+	// profiles are either the names of built-in profiles or
+	// profile files.
+	Callers []server.Caller `json:"callers"`
+}
+
+func main() {
+	flag.Usage = cmd.Usage("usage: %s -cert file -key file -config file [options]", os.Args[0])
+	flag.Parse()
+	if *configFile == "" {
+		cmd.Usagef("no configuration file specified.")
+	}
+	if (*tlsCert == "") != (*tlsKey == "") {
+		cmd.Usagef("-tls-cert and -tls-key must be specified together.")
+	}
+	if *clientCA != "" && *tlsCert == "" {
+		cmd.Usagef("-client-ca requires -tls-cert.")
+	}
+	ctx := context.Background()
+
+	conf, err := readConfig(*configFile)
+	if err != nil {
+		cmd.Fatalf(err, "cannot load configuration")
+	}
+	if *tlsCert == "" {
+		for _, c := range conf.Callers {
+			if c.Token != "" {
+				cmd.Usagef("caller %q has a token, which requires -tls-cert.", c.Name)
+			}
+		}
+	}
+	iss, err := issuer.Load(ctx)
+	if err != nil {
+		cmd.Fatalf(err, "cannot load issuer")
+	}
+	db, err := store.Open()
+	if err != nil {
+		cmd.Fatalf(err, "cannot open certificate store")
+	}
+	p := server.Params{
+		Issuer:      iss,
+		Profiles:    make(map[string]*ca.Profile),
+		Callers:     conf.Callers,
+		Store:       db,
+		CRLValidity: *crlValidity,
+		Logf:        log.Printf,
+	}
+	for _, c := range conf.Callers {
+		for _, name := range c.Profiles {
+			if p.Profiles[name] != nil {
+				continue
+			}
+			p.Profiles[name], err = profile.Load(name)
+			if err != nil {
+				cmd.Fatalf(err, "cannot load profile")
+			}
+		}
+	}
+	srv, err := server.New(p)
+	if err != nil {
+		cmd.Fatalf(err, "cannot create server")
+	}
+	hs := &http.Server{
+		Addr:              *addr,
+		Handler:           srv,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	if *clientCA != "" {
+		crts, err := ca.ReadCertificatesFile(*clientCA)
+		if err != nil {
+			cmd.Fatalf(err, "cannot load client CA certificates")
+		}
+		pool := x509.NewCertPool()
+		for _, crt := range crts {
+			pool.AddCert(crt)
+		}
+		hs.TLSConfig = &tls.Config{
+			ClientAuth: tls.VerifyClientCertIfGiven,
+			ClientCAs:  pool,
+		}
+	}
+	if *tlsCert != "" {
+		err = hs.ListenAndServeTLS(*tlsCert, *tlsKey)
+	} else {
+		err = hs.ListenAndServe()
+	}
+	if err != nil {
+		cmd.Fatalf(err, "cannot serve")
+	}
+}
+
+func readConfig(path string) (*config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot open %s", path)
+	}
+	defer f.Close()
+	var conf config
+	if err := json.NewDecoder(f).Decode(&conf); err != nil {
+		return nil, errgo.Notef(err, "cannot read configuration from %s", path)
+	}
+	return &conf, nil
+}
@@ -3,25 +3,49 @@ package main
 import (
 	"context"
 	"crypto/x509"
+	"encoding/asn1"
 	"flag"
+	"net/url"
 	"os"
+	"strings"
+
+	errgo "gopkg.in/errgo.v1"
 
 	"github.com/mhilton/ca"
 	"github.com/mhilton/ca/cmd/internal/cmd"
+	"github.com/mhilton/ca/cmd/internal/lint"
+	"github.com/mhilton/ca/cmd/internal/outform"
 	"github.com/mhilton/ca/cmd/internal/params"
 	"github.com/mhilton/ca/cmd/internal/passphrase"
+	"github.com/mhilton/ca/cmd/internal/store"
 	"github.com/mhilton/ca/cmd/internal/subject"
 )
 
 var (
-	crtFile = flag.String("cert", "", "`file` containing the signing certificate. (required)")
+	chain   = flag.Bool("chain", false, "append the signing certificate and its chain to the output.")
+	crtFile = flag.String("cert", "", "`file` containing the signing certificate, optionally followed by its chain. (required)")
 	keyFile = flag.String("key", "", "`file` containing the signing key. (required)")
 	csrFile = flag.String("req", "", "`file` containing the certificate request. (required)")
+
+	allowedExtensions oidsVar
+	extensionPolicy   extensionModeVar
+	crlURLs           urlsVar
+	ocspURLs          urlsVar
+	issuerURLs        urlsVar
 )
 
+func init() {
+	flag.Var(&allowedExtensions, "allow-extension", "`OID` of a requested extension that may be copied to the certificate.")
+	flag.Var(&extensionPolicy, "extension-policy", "`policy` for extensions requested in the certificate request: ignore, copy, allow or reject. (default ignore)")
+	flag.Var(&crlURLs, "crl-url", "`URL` of a CRL distribution point to add to the certificate. Overrides the profile.")
+	flag.Var(&ocspURLs, "ocsp-url", "`URL` of an OCSP responder to add to the certificate. Overrides the profile.")
+	flag.Var(&issuerURLs, "issuer-url", "`URL` of the issuing certificate to add to the certificate. Overrides the profile.")
+}
+
 func main() {
 	flag.Usage = cmd.Usage("usage: %s -cert file -key file -req file [options]", os.Args[0])
 	flag.Parse()
+	ctx := context.Background()
 	if *crtFile == "" {
 		cmd.Usagef("no certificate file specified.")
 	}
@@ -32,11 +56,12 @@ func main() {
 		cmd.Usagef("no certificate signing request file specified.")
 	}
 
-	parent, err := ca.ReadCertificateFile(*crtFile)
+	parents, err := ca.ReadCertificatesFile(*crtFile)
 	if err != nil {
 		cmd.Fatalf(err, "cannot load signing certificate")
 	}
-	key, err := ca.ReadKeyFile(context.Background(), *keyFile, passphrase.Getter())
+	parent := parents[0]
+	key, err := ca.ReadKeyFile(ctx, *keyFile, passphrase.Getter())
 	if err != nil {
 		cmd.Fatalf(err, "cannot load signing key")
 	}
@@ -51,16 +76,114 @@ func main() {
 
 	template := x509.Certificate{
 		Subject:        subject.Subject(),
+		RawSubject:     subject.RawSubject(),
 		DNSNames:       subject.DNSNames(),
 		EmailAddresses: subject.EmailAddresses(),
 		IPAddresses:    subject.IPAddresses(),
+		URIs:           subject.URIs(),
 	}
 	params.SetParams(&template)
-	crt, err := ca.SignCertificate(csr, &template, parent, key)
+	if crlURLs != nil {
+		template.CRLDistributionPoints = crlURLs
+	}
+	if ocspURLs != nil {
+		template.OCSPServer = ocspURLs
+	}
+	if issuerURLs != nil {
+		template.IssuingCertificateURL = issuerURLs
+	}
+	uris := template.URIs
+	if len(uris) == 0 {
+		uris = csr.URIs
+	}
+	if err := subject.CheckURIs(uris); err != nil {
+		cmd.Fatalf(err, "invalid URI")
+	}
+	var policy ca.ExtensionPolicy
+	if p := params.Profile(); p != nil {
+		if err := p.CheckRequest(csr); err != nil {
+			cmd.Fatalf(err, "certificate signing request not allowed by profile")
+		}
+		policy = p.Extensions
+	}
+	if extensionPolicy != "" {
+		policy.Mode = ca.ExtensionMode(extensionPolicy)
+	}
+	if len(allowedExtensions) > 0 {
+		policy.Allowed = allowedExtensions
+	}
+	exts, err := policy.Extensions(csr)
 	if err != nil {
+		cmd.Fatalf(err, "certificate signing request not allowed")
+	}
+	ca.AddRequestedExtensions(&template, exts)
+	db, err := store.Open()
+	if err != nil {
+		cmd.Fatalf(err, "cannot open certificate store")
+	}
+	if err := lint.Check(ca.RequestTemplate(csr, &template), parent.PublicKey); err != nil {
 		cmd.Fatalf(err, "cannot sign certificate")
 	}
-	if err := ca.WriteCertificate(os.Stdout, crt); err != nil {
+	crt, err := ca.SignCertificateWithStore(ctx, db, csr, &template, parent, key)
+	if err != nil {
+		cmd.Fatalf(err, "cannot sign certificate")
+	}
+	crts := []*x509.Certificate{crt}
+	if *chain {
+		crts = append(crts, parents...)
+	}
+	if err := outform.WriteCertificates(os.Stdout, crts); err != nil {
 		cmd.Fatalf(err, "cannot write certificate")
 	}
 }
+
+type oidsVar []asn1.ObjectIdentifier
+
+func (v *oidsVar) Set(s string) error {
+	for _, s := range strings.Split(s, ",") {
+		oid, err := ca.ParseOID(s)
+		if err != nil {
+			return errgo.Mask(err)
+		}
+		*v = append(*v, oid)
+	}
+	return nil
+}
+
+func (v oidsVar) String() string {
+	ss := make([]string, len(v))
+	for i, oid := range v {
+		ss[i] = oid.String()
+	}
+	return strings.Join(ss, ",")
+}
+
+type extensionModeVar ca.ExtensionMode
+
+func (v *extensionModeVar) Set(s string) error {
+	switch m := ca.ExtensionMode(s); m {
+	case ca.ExtensionsIgnore, ca.ExtensionsCopy, ca.ExtensionsAllow, ca.ExtensionsReject:
+		*v = extensionModeVar(m)
+		return nil
+	}
+	return errgo.Newf("unknown extension policy %q", s)
+}
+
+func (v extensionModeVar) String() string {
+	return string(v)
+}
+
+type urlsVar []string
+
+func (v *urlsVar) Set(s string) error {
+	u, err := url.Parse(s)
+	if err != nil || !u.IsAbs() {
+		return errgo.Newf("invalid URL %q", s)
+	}
+	*v = append(*v, s)
+	return nil
+}
+
+func (v urlsVar) String() string {
+	return strings.Join(v, ",")
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mhilton/ca"
+	"github.com/mhilton/ca/cmd/internal/cmd"
+	"github.com/mhilton/ca/cmd/internal/passphrase"
+	"github.com/mhilton/ca/ssh"
+)
+
+var (
+	keyFile    = flag.String("key", "", "`file` containing the signing key. (required)")
+	pubKeyFile = flag.String("pubkey", "", "`file` containing the OpenSSH public key to certify.")
+	export     = flag.Bool("export", false, "write the signing key's public key in authorized_keys format instead of signing.")
+	host       = flag.Bool("host", false, "create a host certificate rather than a user certificate.")
+	keyID      = flag.String("id", "", "key `identifier` of the certificate.")
+	principals = flag.String("principals", "", "comma separated `list` of user or host names for which the certificate is valid. (default any)")
+	serial     = flag.Uint64("serial", 0, "serial `number` of the certificate. (default random)")
+	validity   = flag.Duration("validity", 24*time.Hour, "`duration` for which the certificate is valid, 0 means forever.")
+
+	options    mapVar
+	extensions mapVar
+)
+
+func init() {
+	flag.Var(&options, "option", "critical `option` to add to the certificate, as name or name=value (for example force-command=/bin/true).")
+	flag.Var(&extensions, "extension", "`extension` to add to the certificate, as name or name=value. (default the ssh-keygen extensions for user certificates)")
+}
+
+func main() {
+	flag.Usage = cmd.Usage("usage: %s -key file -pubkey file [options]\n       %s -key file -export", os.Args[0], os.Args[0])
+	flag.Parse()
+	ctx := context.Background()
+	if *keyFile == "" {
+		cmd.Usagef("no key file specified.")
+	}
+	if *pubKeyFile == "" && !*export {
+		cmd.Usagef("no public key file specified.")
+	}
+
+	key, err := ca.ReadKeyFile(ctx, *keyFile, passphrase.Getter())
+	if err != nil {
+		cmd.Fatalf(err, "cannot load signing key")
+	}
+	if *export {
+		pub, err := ssh.PublicKey(key.Public())
+		if err != nil {
+			cmd.Fatalf(err, "cannot export public key")
+		}
+		if err := ssh.WriteAuthorizedKey(os.Stdout, pub, ""); err != nil {
+			cmd.Fatalf(err, "cannot write public key")
+		}
+		return
+	}
+	pub, err := ssh.ReadPublicKeyFile(*pubKeyFile)
+	if err != nil {
+		cmd.Fatalf(err, "cannot load public key")
+	}
+	now := time.Now()
+	p := ssh.Params{
+		Type:   ssh.UserCert,
+		KeyID:  *keyID,
+		Serial: *serial,
+		// Allow for the clocks of the machines checking the
+		// certificate being a little behind.
+		ValidAfter:      now.Add(-5 * time.Minute),
+		CriticalOptions: options,
+		Extensions:      extensions,
+	}
+	if *host {
+		p.Type = ssh.HostCert
+	} else if extensions == nil {
+		p.Extensions = ssh.DefaultUserExtensions
+	}
+	if *principals != "" {
+		p.Principals = strings.Split(*principals, ",")
+	}
+	if *validity != 0 {
+		p.ValidBefore = now.Add(*validity)
+	}
+	crt, err := ssh.SignCertificate(key, pub, p)
+	if err != nil {
+		cmd.Fatalf(err, "cannot sign certificate")
+	}
+	if err := ssh.WriteAuthorizedKey(os.Stdout, crt, *keyID); err != nil {
+		cmd.Fatalf(err, "cannot write certificate")
+	}
+}
+
+type mapVar map[string]string
+
+func (v *mapVar) Set(s string) error {
+	if *v == nil {
+		*v = make(mapVar)
+	}
+	name, value := s, ""
+	if i := strings.Index(s, "="); i >= 0 {
+		name, value = s[:i], s[i+1:]
+	}
+	(*v)[name] = value
+	return nil
+}
+
+func (v mapVar) String() string {
+	var ss []string
+	for name, value := range v {
+		if value == "" {
+			ss = append(ss, name)
+		} else {
+			ss = append(ss, name+"="+value)
+		}
+	}
+	return strings.Join(ss, ",")
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	errgo "gopkg.in/errgo.v1"
+
+	"github.com/mhilton/ca"
+	"github.com/mhilton/ca/cmd/internal/cmd"
+)
+
+var (
+	rootsFile         = flag.String("roots", "", "`file` containing the trusted root certificates. (required)")
+	intermediatesFile = flag.String("intermediates", "", "`file` containing intermediate certificates.")
+	hostname          = flag.String("hostname", "", "`name` that the certificate must be valid for.")
+	requireCRL        = flag.Bool("require-crl", false, "fail unless every certificate in the chain is covered by a CRL.")
+
+	crlFiles    filesVar
+	extKeyUsage extKeyUsageVar
+	verifyTime  timeVar
+)
+
+func init() {
+	flag.Var(&crlFiles, "crl", "`file` containing a CRL used to check for revoked certificates. May be repeated.")
+	flag.Var(&extKeyUsage, "ext-key-usage", "extended key `usage` that the chain must be valid for (such as serverAuth). (default any)")
+	flag.Var(&verifyTime, "time", "`time` at which to verify the chain. (default now)")
+}
+
+func main() {
+	flag.Usage = cmd.Usage("usage: %s -roots file [options] certificate-file", os.Args[0])
+	flag.Parse()
+	if *rootsFile == "" {
+		cmd.Usagef("no roots file specified.")
+	}
+	if flag.NArg() != 1 {
+		cmd.Usagef("a single certificate file must be specified.")
+	}
+
+	// Any certificates following the leaf are treated as
+	// intermediates, so that bundles can be verified directly.
+	crts, err := ca.ReadCertificatesFile(flag.Arg(0))
+	if err != nil {
+		cmd.Fatalf(err, "cannot load certificate")
+	}
+	opts := ca.VerifyOptions{
+		Intermediates: crts[1:],
+		DNSName:       *hostname,
+		CurrentTime:   time.Time(verifyTime),
+		KeyUsages:     extKeyUsage,
+		RequireCRL:    *requireCRL,
+	}
+	opts.Roots, err = ca.ReadCertificatesFile(*rootsFile)
+	if err != nil {
+		cmd.Fatalf(err, "cannot load roots")
+	}
+	if *intermediatesFile != "" {
+		intermediates, err := ca.ReadCertificatesFile(*intermediatesFile)
+		if err != nil {
+			cmd.Fatalf(err, "cannot load intermediates")
+		}
+		opts.Intermediates = append(opts.Intermediates, intermediates...)
+	}
+	for _, path := range crlFiles {
+		crl, err := ca.ReadCRLFile(path)
+		if err != nil {
+			cmd.Fatalf(err, "cannot load CRL")
+		}
+		opts.CRLs = append(opts.CRLs, crl)
+	}
+	chain, err := ca.VerifyChain(crts[0], opts)
+	if err != nil {
+		cmd.Fatalf(err, "verification failed")
+	}
+	for i, crt := range chain {
+		fmt.Printf("%d: %s (serial 0x%X)\n", i, crt.Subject, crt.SerialNumber)
+	}
+}
+
+type filesVar []string
+
+func (v *filesVar) Set(s string) error {
+	*v = append(*v, s)
+	return nil
+}
+
+func (v filesVar) String() string {
+	return strings.Join(v, ",")
+}
+
+type extKeyUsageVar []x509.ExtKeyUsage
+
+func (v *extKeyUsageVar) Set(s string) error {
+	for _, s := range strings.Split(s, ",") {
+		eku, oid, err := ca.ParseExtKeyUsage(s)
+		if err != nil {
+			return errgo.Mask(err)
+		}
+		if oid != nil {
+			return errgo.Newf("unsupported extended key usage %q", s)
+		}
+		*v = append(*v, eku)
+	}
+	return nil
+}
+
+func (v extKeyUsageVar) String() string {
+	ss := make([]string, len(v))
+	for i, eku := range v {
+		ss[i] = ca.ExtKeyUsageName(eku)
+	}
+	return strings.Join(ss, ",")
+}
+
+type timeVar time.Time
+
+func (v *timeVar) Set(s string) error {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return errgo.Notef(err, "cannot parse")
+	}
+	*v = timeVar(t)
+	return nil
+}
+
+func (v timeVar) String() string {
+	if time.Time(v).IsZero() {
+		return ""
+	}
+	return time.Time(v).Format(time.RFC3339)
+}
@@ -0,0 +1,31 @@
+// Package bigint provides a flag value holding an arbitrary precision
+// integer, such as a serial number.
+package bigint
+
+import (
+	"math/big"
+
+	errgo "gopkg.in/errgo.v1"
+)
+
+// Var is a flag.Value holding an integer. The integer may be given in
+// decimal, or in hexadecimal with a 0x prefix.
+type Var struct {
+	N *big.Int
+}
+
+func (v *Var) Set(s string) error {
+	var ok bool
+	v.N, ok = new(big.Int).SetString(s, 0)
+	if !ok {
+		return errgo.Newf("invalid number %q", s)
+	}
+	return nil
+}
+
+func (v Var) String() string {
+	if v.N == nil {
+		return ""
+	}
+	return "0x" + v.N.Text(16)
+}
@@ -0,0 +1,55 @@
+package issuer
+
+import (
+	"context"
+	"crypto/x509"
+	"flag"
+
+	errgo "gopkg.in/errgo.v1"
+
+	"github.com/mhilton/ca"
+	"github.com/mhilton/ca/cmd/internal/lint"
+	"github.com/mhilton/ca/cmd/internal/passphrase"
+	"github.com/mhilton/ca/cmd/internal/store"
+)
+
+var (
+	crtFile = flag.String("cert", "", "`file` containing the signing certificate, optionally followed by its chain. (required)")
+	keyFile = flag.String("key", "", "`file` containing the signing key. (required)")
+)
+
+// Load loads the issuer specified with the -cert and -key flags. If a
+// certificate store was specified with the -db flag then it is used to
+// record issued certificates. Certificates are checked as specified by
+// the lint flags before they are issued.
+func Load(ctx context.Context) (*ca.Issuer, error) {
+	if *crtFile == "" {
+		return nil, errgo.New("no certificate file specified")
+	}
+	if *keyFile == "" {
+		return nil, errgo.New("no key file specified")
+	}
+	crts, err := ca.ReadCertificatesFile(*crtFile)
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot load signing certificate")
+	}
+	key, err := ca.ReadKeyFile(ctx, *keyFile, passphrase.Getter())
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot load signing key")
+	}
+	iss, err := ca.NewIssuer(crts[0], key, crts[1:]...)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	iss.SetLinter(func(template *x509.Certificate) error {
+		return lint.Check(template, crts[0].PublicKey)
+	})
+	db, err := store.Open()
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot open certificate store")
+	}
+	if db != nil {
+		iss.SetStore(db)
+	}
+	return iss, nil
+}
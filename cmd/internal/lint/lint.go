@@ -0,0 +1,66 @@
+// Package lint provides flags that control the checks made on
+// certificates before they are signed.
+package lint
+
+import (
+	"crypto"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	errgo "gopkg.in/errgo.v1"
+
+	calint "github.com/mhilton/ca/lint"
+)
+
+var (
+	mode       = modeVar("error")
+	maxDays    = flag.Int("lint-max-days", int(calint.DefaultMaxValidity/(24*time.Hour)), "maximum number of `days` for which an end-entity certificate may be valid.")
+	minRSABits = flag.Int("lint-min-rsa-bits", calint.DefaultMinRSABits, "minimum `size` of an RSA key.")
+)
+
+func init() {
+	flag.Var(&mode, "lint", "`action` taken when a certificate fails lint checks before signing: error, warn or none.")
+}
+
+// Check checks the given certificate template, which must have its
+// PublicKey set, as specified by the lint flags. The issuerKey is the
+// public key that will sign the certificate. Problems are reported on
+// stderr. If -lint is error and any problems have error severity then
+// an error is returned.
+func Check(template *x509.Certificate, issuerKey crypto.PublicKey) error {
+	if mode == "none" {
+		return nil
+	}
+	problems := calint.Check(template, &calint.Options{
+		MaxValidity: time.Duration(*maxDays) * 24 * time.Hour,
+		MinRSABits:  *minRSABits,
+		IssuerKey:   issuerKey,
+	})
+	for _, p := range problems {
+		if mode == "warn" || p.Severity == calint.Warning {
+			fmt.Fprintf(os.Stderr, "lint %s\n", p)
+		}
+	}
+	if mode == "error" {
+		return calint.Err(problems)
+	}
+	return nil
+}
+
+type modeVar string
+
+func (v *modeVar) Set(s string) error {
+	switch s {
+	case "error", "warn", "none":
+		*v = modeVar(s)
+		return nil
+	}
+	return errgo.Newf("unknown lint action %q", s)
+}
+
+func (v modeVar) String() string {
+	return string(v)
+}
@@ -0,0 +1,69 @@
+package outform
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"flag"
+	"io"
+
+	errgo "gopkg.in/errgo.v1"
+
+	"github.com/mhilton/ca"
+)
+
+var format = formatVar("pem")
+
+func init() {
+	flag.Var(&format, "outform", "output `format` (pem or der). DER output of several objects is their concatenation.")
+}
+
+// DER reports whether DER output was specified with the -outform flag.
+func DER() bool {
+	return format == "der"
+}
+
+// Write writes the given blocks in the format specified with the
+// -outform flag.
+func Write(w io.Writer, bs ...*pem.Block) error {
+	for _, b := range bs {
+		var err error
+		if format == "der" {
+			err = ca.WriteDER(w, b)
+		} else {
+			err = ca.WritePEM(w, b)
+		}
+		if err != nil {
+			return errgo.Mask(err)
+		}
+	}
+	return nil
+}
+
+// WriteCertificates writes the given certificates in the format
+// specified with the -outform flag.
+func WriteCertificates(w io.Writer, crts []*x509.Certificate) error {
+	bs := make([]*pem.Block, len(crts))
+	for i, crt := range crts {
+		var err error
+		bs[i], err = ca.MarshalCertificate(crt)
+		if err != nil {
+			return errgo.Mask(err)
+		}
+	}
+	return Write(w, bs...)
+}
+
+type formatVar string
+
+func (v *formatVar) Set(s string) error {
+	switch s {
+	case "pem", "der":
+		*v = formatVar(s)
+		return nil
+	}
+	return errgo.Newf("unknown format %q", s)
+}
+
+func (v formatVar) String() string {
+	return string(v)
+}
@@ -2,44 +2,144 @@ package params
 
 import (
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
 	"flag"
-	"math/big"
+	"net"
+	"strings"
 	"time"
 
 	errgo "gopkg.in/errgo.v1"
+
+	"github.com/mhilton/ca"
+	"github.com/mhilton/ca/cmd/internal/bigint"
 )
 
 var (
 	days         = flag.Int("days", 30, "Number of `days` for which the certificate will be valid.")
 	isCA         = flag.Bool("ca", false, "certificate can be used to sign other certificates.")
 	maxPathLen   = flag.Int("max-path-len", -1, "maximum path `length` for certificates signed by this certificate (-1 implies no maximum)")
+	extKeyUsage  extKeyUsageVar
+	keyUsage     keyUsageVar
 	notAfter     timeVar
 	notBefore    timeVar
-	serialNumber bigIntVar
+	profile      profileVar
+	serialNumber bigint.Var
+	policies     oidsVar
+	extensions   extensionsVar
+
+	nameConstraintsCritical = flag.Bool("name-constraints-critical", false, "mark the name constraints extension as critical.")
+	permittedDNSDomains     stringsVar
+	excludedDNSDomains      stringsVar
+	permittedIPRanges       ipRangesVar
+	excludedIPRanges        ipRangesVar
+	permittedEmails         stringsVar
+	excludedEmails          stringsVar
+	permittedURIDomains     stringsVar
+	excludedURIDomains      stringsVar
 )
 
 func init() {
+	flag.Var(&extKeyUsage, "ext-key-usage", "extended key `usage` of the certificate, either a name (such as serverAuth or clientAuth) or an OID.")
+	flag.Var(&keyUsage, "key-usage", "key `usage` of the certificate (such as digitalSignature or keyCertSign). (default digitalSignature,keyCertSign,cRLSign with -ca)")
 	flag.Var(&notAfter, "not-after", "`time` after which the certificate is invalid. (overrides -days)")
 	flag.Var(&notBefore, "not-before", "`time` before which the certificate is invalid. (default now)")
+	flag.Var(&profile, "profile", "certificate `profile`, either a built-in profile (server, client, intermediate or root) or a profile file. Other flags override the profile.")
 	flag.Var(&serialNumber, "serial", "serial number to assign to the certificate.")
+	flag.Var(&policies, "policy", "`OID` of a certificate policy to add to the certificate.")
+	flag.Var(&extensions, "extension", "`extension` to add to the certificate, in the form oid[,critical]=value. The value is der:base64, hex:hex or asn1:type:text, for example asn1:UTF8String:text.")
+	flag.Var(&permittedDNSDomains, "permitted-dns-domain", "`domain` that names in certificates signed by this CA must be in. (CA certificates only)")
+	flag.Var(&excludedDNSDomains, "excluded-dns-domain", "`domain` that names in certificates signed by this CA must not be in. (CA certificates only)")
+	flag.Var(&permittedIPRanges, "permitted-ip-range", "`CIDR` range that IP addresses in certificates signed by this CA must be in. (CA certificates only)")
+	flag.Var(&excludedIPRanges, "excluded-ip-range", "`CIDR` range that IP addresses in certificates signed by this CA must not be in. (CA certificates only)")
+	flag.Var(&permittedEmails, "permitted-email", "`mailbox or domain` that email addresses in certificates signed by this CA must match. (CA certificates only)")
+	flag.Var(&excludedEmails, "excluded-email", "`mailbox or domain` that email addresses in certificates signed by this CA must not match. (CA certificates only)")
+	flag.Var(&permittedURIDomains, "permitted-uri-domain", "`domain` that URI hosts in certificates signed by this CA must be in. (CA certificates only)")
+	flag.Var(&excludedURIDomains, "excluded-uri-domain", "`domain` that URI hosts in certificates signed by this CA must not be in. (CA certificates only)")
+}
+
+// Profile returns the profile specified with the -profile flag, or
+// nil if there was none.
+func Profile() *ca.Profile {
+	return profile.p
 }
 
 func SetParams(template *x509.Certificate) {
-	template.SerialNumber = serialNumber.n
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	template.SerialNumber = serialNumber.N
 	template.NotBefore = time.Time(notBefore)
 	if template.NotBefore.IsZero() {
 		template.NotBefore = time.Now()
 	}
-	template.NotAfter = time.Time(notAfter)
-	if template.NotAfter.IsZero() {
-		template.NotAfter = template.NotBefore.Add(time.Duration(*days) * 24 * time.Hour)
+	if profile.p != nil {
+		profile.p.Apply(template, template.NotBefore)
 	}
 	template.BasicConstraintsValid = true
-	template.IsCA = *isCA
+	if profile.p == nil || profile.p.Validity == 0 || set["days"] {
+		template.NotAfter = template.NotBefore.Add(time.Duration(*days) * 24 * time.Hour)
+	}
+	if !time.Time(notAfter).IsZero() {
+		template.NotAfter = time.Time(notAfter)
+	}
+	if profile.p == nil || set["ca"] {
+		template.IsCA = *isCA
+	}
 	if *maxPathLen >= 0 {
 		template.MaxPathLen = *maxPathLen
 		template.MaxPathLenZero = template.MaxPathLen == 0
 	}
+	if set["key-usage"] {
+		template.KeyUsage = keyUsage.usage
+	} else if profile.p == nil && template.IsCA {
+		template.KeyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	}
+	if set["ext-key-usage"] {
+		template.ExtKeyUsage = extKeyUsage.usages
+		template.UnknownExtKeyUsage = extKeyUsage.oids
+	}
+	if template.IsCA {
+		setNameConstraints(template, set)
+	}
+	if set["policy"] {
+		template.PolicyIdentifiers = policies
+	}
+	template.ExtraExtensions = ca.MergeExtensions(extensions, template.ExtraExtensions...)
+}
+
+// setNameConstraints sets the name constraints specified by flags on
+// template, overriding any from the profile.
+func setNameConstraints(template *x509.Certificate, set map[string]bool) {
+	if set["name-constraints-critical"] {
+		template.PermittedDNSDomainsCritical = *nameConstraintsCritical
+	}
+	if set["permitted-dns-domain"] {
+		template.PermittedDNSDomains = permittedDNSDomains
+	}
+	if set["excluded-dns-domain"] {
+		template.ExcludedDNSDomains = excludedDNSDomains
+	}
+	if set["permitted-ip-range"] {
+		template.PermittedIPRanges = permittedIPRanges
+	}
+	if set["excluded-ip-range"] {
+		template.ExcludedIPRanges = excludedIPRanges
+	}
+	if set["permitted-email"] {
+		template.PermittedEmailAddresses = permittedEmails
+	}
+	if set["excluded-email"] {
+		template.ExcludedEmailAddresses = excludedEmails
+	}
+	if set["permitted-uri-domain"] {
+		template.PermittedURIDomains = permittedURIDomains
+	}
+	if set["excluded-uri-domain"] {
+		template.ExcludedURIDomains = excludedURIDomains
+	}
 }
 
 type timeVar time.Time
@@ -60,22 +160,148 @@ func (v timeVar) String() string {
 	return time.Time(v).Format(time.RFC3339)
 }
 
-type bigIntVar struct {
-	n *big.Int
+type profileVar struct {
+	name string
+	p    *ca.Profile
 }
 
-func (v *bigIntVar) Set(s string) error {
-	var ok bool
-	v.n, ok = new(big.Int).SetString(s, 0)
-	if !ok {
-		return errgo.Newf("invalid number %q", s)
+func (v *profileVar) Set(s string) error {
+	p, err := ca.BuiltinProfile(s)
+	if err != nil {
+		p, err = ca.ReadProfileFile(s)
 	}
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	v.name = s
+	v.p = p
 	return nil
 }
 
-func (v bigIntVar) String() string {
-	if v.n == nil {
-		return ""
+func (v profileVar) String() string {
+	return v.name
+}
+
+type keyUsageVar struct {
+	names []string
+	usage x509.KeyUsage
+}
+
+func (v *keyUsageVar) Set(s string) error {
+	for _, s := range strings.Split(s, ",") {
+		ku, err := ca.ParseKeyUsage(s)
+		if err != nil {
+			return errgo.Mask(err)
+		}
+		v.names = append(v.names, s)
+		v.usage |= ku
+	}
+	return nil
+}
+
+func (v keyUsageVar) String() string {
+	return strings.Join(v.names, ",")
+}
+
+type extKeyUsageVar struct {
+	names  []string
+	usages []x509.ExtKeyUsage
+	oids   []asn1.ObjectIdentifier
+}
+
+func (v *extKeyUsageVar) Set(s string) error {
+	for _, s := range strings.Split(s, ",") {
+		eku, oid, err := ca.ParseExtKeyUsage(s)
+		if err != nil {
+			return errgo.Mask(err)
+		}
+		v.names = append(v.names, s)
+		if oid != nil {
+			v.oids = append(v.oids, oid)
+		} else {
+			v.usages = append(v.usages, eku)
+		}
+	}
+	return nil
+}
+
+func (v extKeyUsageVar) String() string {
+	return strings.Join(v.names, ",")
+}
+
+type stringsVar []string
+
+func (v *stringsVar) Set(s string) error {
+	*v = append(*v, strings.Split(s, ",")...)
+	return nil
+}
+
+func (v stringsVar) String() string {
+	return strings.Join(v, ",")
+}
+
+type ipRangesVar []*net.IPNet
+
+func (v *ipRangesVar) Set(s string) error {
+	for _, s := range strings.Split(s, ",") {
+		_, ipnet, err := net.ParseCIDR(s)
+		if err != nil {
+			return errgo.Newf("invalid IP range %q", s)
+		}
+		*v = append(*v, ipnet)
+	}
+	return nil
+}
+
+func (v ipRangesVar) String() string {
+	ss := make([]string, len(v))
+	for i, r := range v {
+		ss[i] = r.String()
+	}
+	return strings.Join(ss, ",")
+}
+
+type oidsVar []asn1.ObjectIdentifier
+
+func (v *oidsVar) Set(s string) error {
+	for _, s := range strings.Split(s, ",") {
+		oid, err := ca.ParseOID(s)
+		if err != nil {
+			return errgo.Mask(err)
+		}
+		*v = append(*v, oid)
+	}
+	return nil
+}
+
+func (v oidsVar) String() string {
+	ss := make([]string, len(v))
+	for i, oid := range v {
+		ss[i] = oid.String()
+	}
+	return strings.Join(ss, ",")
+}
+
+type extensionsVar []pkix.Extension
+
+func (v *extensionsVar) Set(s string) error {
+	ext, err := ca.ParseExtension(s)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	for _, e := range *v {
+		if e.Id.Equal(ext.Id) {
+			return errgo.Newf("extension %s specified more than once", ext.Id)
+		}
+	}
+	*v = append(*v, ext)
+	return nil
+}
+
+func (v extensionsVar) String() string {
+	ss := make([]string, len(v))
+	for i, ext := range v {
+		ss[i] = ext.Id.String()
 	}
-	return "0x" + v.n.Text(16)
+	return strings.Join(ss, " ")
 }
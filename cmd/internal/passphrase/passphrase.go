@@ -31,6 +31,30 @@ func Getter() ca.PassphraseGetter {
 	return interactivePassphraseGetter{}
 }
 
+// Reuse returns a PassphraseGetter that gets a passphrase from pg the
+// first time it is called and returns the same passphrase thereafter,
+// so that a user is only asked once.
+func Reuse(pg ca.PassphraseGetter) ca.PassphraseGetter {
+	return &reusePassphraseGetter{pg: pg}
+}
+
+type reusePassphraseGetter struct {
+	pg         ca.PassphraseGetter
+	passphrase []byte
+	ok         bool
+}
+
+func (pg *reusePassphraseGetter) GetPassphrase(ctx context.Context) ([]byte, error) {
+	if !pg.ok {
+		passphrase, err := pg.pg.GetPassphrase(ctx)
+		if err != nil {
+			return nil, errgo.Mask(err, errgo.Any)
+		}
+		pg.passphrase, pg.ok = passphrase, true
+	}
+	return pg.passphrase, nil
+}
+
 type constPassphraseGetter struct {
 	passphrase []byte
 }
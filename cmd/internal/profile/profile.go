@@ -0,0 +1,14 @@
+package profile
+
+import (
+	"github.com/mhilton/ca"
+)
+
+// Load loads the named profile, which is either the name of a built-in
+// profile or a profile file.
+func Load(name string) (*ca.Profile, error) {
+	if p, err := ca.BuiltinProfile(name); err == nil {
+		return p, nil
+	}
+	return ca.ReadProfileFile(name)
+}
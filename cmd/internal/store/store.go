@@ -0,0 +1,26 @@
+package store
+
+import (
+	"flag"
+
+	errgo "gopkg.in/errgo.v1"
+
+	"github.com/mhilton/ca"
+)
+
+var (
+	dir = flag.String("db", "", "`directory` holding the record of issued certificates.")
+)
+
+// Open opens the store specified with the -db flag. If no store was
+// specified it returns nil.
+func Open() (ca.Store, error) {
+	if *dir == "" {
+		return nil, nil
+	}
+	s, err := ca.NewDirStore(*dir)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	return s, nil
+}
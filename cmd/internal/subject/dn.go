@@ -0,0 +1,340 @@
+package subject
+
+import (
+	"bytes"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"strings"
+	"unicode/utf8"
+
+	errgo "gopkg.in/errgo.v1"
+
+	"github.com/mhilton/ca"
+)
+
+// attributeTypes holds the names of the attribute types that can be
+// used in a distinguished name. Other types must be specified by OID.
+var attributeTypes = []struct {
+	name string
+	oid  asn1.ObjectIdentifier
+	ia5  bool
+}{
+	{"CN", asn1.ObjectIdentifier{2, 5, 4, 3}, false},
+	{"SERIALNUMBER", asn1.ObjectIdentifier{2, 5, 4, 5}, false},
+	{"C", asn1.ObjectIdentifier{2, 5, 4, 6}, false},
+	{"L", asn1.ObjectIdentifier{2, 5, 4, 7}, false},
+	{"ST", asn1.ObjectIdentifier{2, 5, 4, 8}, false},
+	{"STREET", asn1.ObjectIdentifier{2, 5, 4, 9}, false},
+	{"O", asn1.ObjectIdentifier{2, 5, 4, 10}, false},
+	{"OU", asn1.ObjectIdentifier{2, 5, 4, 11}, false},
+	{"PC", asn1.ObjectIdentifier{2, 5, 4, 17}, false},
+	{"DC", asn1.ObjectIdentifier{0, 9, 2342, 19200300, 100, 1, 25}, true},
+	{"UID", asn1.ObjectIdentifier{0, 9, 2342, 19200300, 100, 1, 1}, false},
+	{"emailAddress", asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 1}, true},
+}
+
+func parseAttributeType(s string) (asn1.ObjectIdentifier, error) {
+	for _, t := range attributeTypes {
+		if strings.EqualFold(t.name, s) {
+			return t.oid, nil
+		}
+	}
+	oid := s
+	if len(oid) > 4 && strings.EqualFold(oid[:4], "OID.") {
+		oid = oid[4:]
+	}
+	if oid == "" || oid[0] < '0' || oid[0] > '9' {
+		return nil, errgo.Newf("unrecognised attribute type %q", s)
+	}
+	return ca.ParseOID(oid)
+}
+
+func attributeTypeName(oid asn1.ObjectIdentifier) string {
+	for _, t := range attributeTypes {
+		if t.oid.Equal(oid) {
+			return t.name
+		}
+	}
+	return oid.String()
+}
+
+func isIA5Type(oid asn1.ObjectIdentifier) bool {
+	for _, t := range attributeTypes {
+		if t.oid.Equal(oid) {
+			return t.ia5
+		}
+	}
+	return false
+}
+
+// parseDN parses a distinguished name in the string form described in
+// RFC 4514. As in that form, the RDNs are written in the reverse of
+// the order in which they appear in the encoded name, so "CN=x,O=y"
+// encodes O before CN. Values may be quoted, contain backslash
+// escapes or be a '#' followed by the hex encoding of a DER value.
+// Whitespace around separators is ignored.
+func parseDN(s string) (pkix.RDNSequence, error) {
+	var rdns pkix.RDNSequence
+	if strings.TrimSpace(s) == "" {
+		return rdns, nil
+	}
+	p := &dnParser{s: s}
+	var rdn pkix.RelativeDistinguishedNameSET
+	for {
+		atv, err := p.parseAttributeTypeAndValue()
+		if err != nil {
+			return nil, errgo.Mask(err)
+		}
+		rdn = append(rdn, atv)
+		if p.i == len(p.s) {
+			break
+		}
+		sep := p.s[p.i]
+		p.i++
+		if sep == ',' {
+			rdns = append(rdns, rdn)
+			rdn = nil
+		}
+	}
+	rdns = append(rdns, rdn)
+	for i, j := 0, len(rdns)-1; i < j; i, j = i+1, j-1 {
+		rdns[i], rdns[j] = rdns[j], rdns[i]
+	}
+	return rdns, nil
+}
+
+type dnParser struct {
+	s string
+	i int
+}
+
+func (p *dnParser) skipSpace() {
+	for p.i < len(p.s) && p.s[p.i] == ' ' {
+		p.i++
+	}
+}
+
+func (p *dnParser) parseAttributeTypeAndValue() (pkix.AttributeTypeAndValue, error) {
+	var atv pkix.AttributeTypeAndValue
+	n := strings.IndexByte(p.s[p.i:], '=')
+	if n < 0 {
+		return atv, errgo.Newf("invalid name component %q", strings.TrimSpace(p.s[p.i:]))
+	}
+	typ := strings.TrimSpace(p.s[p.i : p.i+n])
+	var err error
+	atv.Type, err = parseAttributeType(typ)
+	if err != nil {
+		return atv, errgo.Mask(err)
+	}
+	p.i += n + 1
+	p.skipSpace()
+	switch {
+	case p.i < len(p.s) && p.s[p.i] == '#':
+		atv.Value, err = p.parseHexValue()
+	case p.i < len(p.s) && p.s[p.i] == '"':
+		atv.Value, err = p.parseQuotedValue()
+	default:
+		atv.Value, err = p.parseStringValue()
+	}
+	if err != nil {
+		return atv, errgo.Notef(err, "invalid value for %s", typ)
+	}
+	if s, ok := atv.Value.(string); ok && isIA5Type(atv.Type) && !isASCII(s) {
+		return atv, errgo.Newf("invalid value for %s: %q is not ASCII", typ, s)
+	}
+	return atv, nil
+}
+
+func (p *dnParser) parseHexValue() (interface{}, error) {
+	start := p.i + 1
+	for p.i++; p.i < len(p.s) && strings.IndexByte(" ,+", p.s[p.i]) < 0; p.i++ {
+	}
+	v, err := hex.DecodeString(p.s[start:p.i])
+	if err != nil {
+		return nil, errgo.Newf("invalid hex string %q", p.s[start:p.i])
+	}
+	var raw asn1.RawValue
+	if rest, err := asn1.Unmarshal(v, &raw); err != nil || len(rest) > 0 {
+		return nil, errgo.Newf("hex string %q is not a DER encoded value", p.s[start:p.i])
+	}
+	if err := p.endValue(); err != nil {
+		return nil, errgo.Mask(err)
+	}
+	return raw, nil
+}
+
+func (p *dnParser) parseQuotedValue() (interface{}, error) {
+	var buf bytes.Buffer
+	for p.i++; ; p.i++ {
+		if p.i == len(p.s) {
+			return nil, errgo.New("unterminated quoted value")
+		}
+		c := p.s[p.i]
+		if c == '"' {
+			p.i++
+			break
+		}
+		if c == '\\' {
+			if err := p.parseEscape(&buf); err != nil {
+				return nil, errgo.Mask(err)
+			}
+			continue
+		}
+		buf.WriteByte(c)
+	}
+	if err := p.endValue(); err != nil {
+		return nil, errgo.Mask(err)
+	}
+	return checkUTF8(buf.Bytes())
+}
+
+func (p *dnParser) parseStringValue() (interface{}, error) {
+	var buf bytes.Buffer
+	// end holds the length of buf up to the last character that is
+	// not an unescaped space.
+	end := 0
+	for ; p.i < len(p.s); p.i++ {
+		c := p.s[p.i]
+		if c == ',' || c == '+' {
+			break
+		}
+		switch c {
+		case '\\':
+			if err := p.parseEscape(&buf); err != nil {
+				return nil, errgo.Mask(err)
+			}
+			end = buf.Len()
+		case '"':
+			return nil, errgo.New("unescaped '\"'")
+		default:
+			buf.WriteByte(c)
+			if c != ' ' {
+				end = buf.Len()
+			}
+		}
+	}
+	return checkUTF8(buf.Bytes()[:end])
+}
+
+// parseEscape parses the escape sequence starting at the backslash at
+// p.i, writing the escaped byte to buf. On return p.i is at the last
+// character of the sequence.
+func (p *dnParser) parseEscape(buf *bytes.Buffer) error {
+	if p.i+1 == len(p.s) {
+		return errgo.New("incomplete escape sequence")
+	}
+	if c := p.s[p.i+1]; strings.IndexByte(`\ "#+,;<=>`, c) >= 0 {
+		buf.WriteByte(c)
+		p.i++
+		return nil
+	}
+	if p.i+2 < len(p.s) && isHex(p.s[p.i+1]) && isHex(p.s[p.i+2]) {
+		b, _ := hex.DecodeString(p.s[p.i+1 : p.i+3])
+		buf.Write(b)
+		p.i += 2
+		return nil
+	}
+	return errgo.Newf("invalid escape sequence at %q", p.s[p.i:])
+}
+
+// endValue checks that only whitespace remains before the next
+// separator or the end of the name.
+func (p *dnParser) endValue() error {
+	p.skipSpace()
+	if p.i < len(p.s) && p.s[p.i] != ',' && p.s[p.i] != '+' {
+		return errgo.Newf("unexpected %q after value", p.s[p.i:])
+	}
+	return nil
+}
+
+func checkUTF8(b []byte) (interface{}, error) {
+	if !utf8.Valid(b) {
+		return nil, errgo.New("value is not valid UTF-8")
+	}
+	return string(b), nil
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// formatDN formats rdns in the string form described in RFC 4514, such
+// that parseDN will return an equivalent sequence.
+func formatDN(rdns pkix.RDNSequence) string {
+	var buf bytes.Buffer
+	for i := len(rdns) - 1; i >= 0; i-- {
+		if i != len(rdns)-1 {
+			buf.WriteString(", ")
+		}
+		for j, atv := range rdns[i] {
+			if j > 0 {
+				buf.WriteString(" + ")
+			}
+			buf.WriteString(attributeTypeName(atv.Type))
+			buf.WriteByte('=')
+			switch v := atv.Value.(type) {
+			case string:
+				buf.WriteString(escapeValue(v))
+			case asn1.RawValue:
+				buf.WriteByte('#')
+				buf.WriteString(hex.EncodeToString(v.FullBytes))
+			}
+		}
+	}
+	return buf.String()
+}
+
+func escapeValue(s string) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case strings.IndexByte(`\"+,;<=>`, c) >= 0,
+			c == '#' && i == 0,
+			c == ' ' && (i == 0 || i == len(s)-1):
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case c < ' ' || c == 0x7f:
+			buf.WriteByte('\\')
+			buf.WriteString(hex.EncodeToString([]byte{c}))
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	return buf.String()
+}
+
+// marshalDN returns the DER encoding of rdns. Values of attribute types
+// that require it are encoded as IA5String, other string values are
+// encoded as PrintableString where possible and UTF8String otherwise.
+func marshalDN(rdns pkix.RDNSequence) ([]byte, error) {
+	enc := make(pkix.RDNSequence, len(rdns))
+	for i, rdn := range rdns {
+		enc[i] = make(pkix.RelativeDistinguishedNameSET, len(rdn))
+		for j, atv := range rdn {
+			if s, ok := atv.Value.(string); ok && isIA5Type(atv.Type) {
+				der, err := asn1.MarshalWithParams(s, "ia5")
+				if err != nil {
+					return nil, errgo.Mask(err)
+				}
+				atv.Value = asn1.RawValue{FullBytes: der}
+			}
+			enc[i][j] = atv
+		}
+	}
+	der, err := asn1.Marshal(enc)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	return der, nil
+}
@@ -0,0 +1,94 @@
+package subject
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseDN(t *testing.T) {
+	tests := []struct {
+		dn   string
+		want string
+	}{
+		{``, ``},
+		{`CN=example.com,O=Acme\, Inc.,C=GB`, `CN=example.com, O=Acme\, Inc., C=GB`},
+		{` CN = a , O = b `, `CN=a, O=b`},
+		{`CN="a, b"`, `CN=a\, b`},
+		{`CN="say \"hi\""`, `CN=say \"hi\"`},
+		{`CN=a+UID=jsmith,DC=example,DC=com`, `CN=a + UID=jsmith, DC=example, DC=com`},
+		{`CN=#0c0568656c6c6f`, `CN=#0c0568656c6c6f`},
+		{`CN=\23x \20`, `CN=\#x \ `},
+		{`CN=caf\c3\a9`, `CN=café`},
+		{`1.2.3.4=foo`, `1.2.3.4=foo`},
+		{`OID.2.5.4.3=x`, `CN=x`},
+		{`cn=x,emailaddress=a@example.com`, `CN=x, emailAddress=a@example.com`},
+	}
+	for _, test := range tests {
+		rdns, err := parseDN(test.dn)
+		if err != nil {
+			t.Errorf("parseDN(%q): %v", test.dn, err)
+			continue
+		}
+		got := formatDN(rdns)
+		if got != test.want {
+			t.Errorf("parseDN(%q): got %q, want %q", test.dn, got, test.want)
+		}
+		rdns, err = parseDN(got)
+		if err != nil {
+			t.Errorf("parseDN(%q): %v", got, err)
+			continue
+		}
+		if again := formatDN(rdns); again != got {
+			t.Errorf("round trip of %q: got %q", got, again)
+		}
+	}
+}
+
+func TestParseDNOrder(t *testing.T) {
+	rdns, err := parseDN(`CN=x,O=y`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rdns) != 2 || rdns[0][0].Value != "y" || rdns[1][0].Value != "x" {
+		t.Errorf("unexpected RDN sequence %v", rdns)
+	}
+}
+
+func TestParseDNErrors(t *testing.T) {
+	for _, dn := range []string{
+		`X=y`,
+		`novalue`,
+		`CN=x,`,
+		`CN="unterminated`,
+		`CN="a" b`,
+		`CN=a"b`,
+		`CN=\`,
+		`CN=\zz`,
+		`CN=#zz`,
+		`CN=#0c05`,
+		`CN=\ff`,
+		`DC=caf\c3\a9`,
+	} {
+		if _, err := parseDN(dn); err == nil {
+			t.Errorf("parseDN(%q): expected error", dn)
+		}
+	}
+}
+
+func TestMarshalDN(t *testing.T) {
+	rdns, err := parseDN(`CN=x,DC=example`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := marshalDN(rdns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// DC values are IA5String, other values PrintableString.
+	if !bytes.Contains(der, []byte("\x16\x07example")) {
+		t.Errorf("DC not encoded as IA5String: %x", der)
+	}
+	if !bytes.Contains(der, []byte("\x13\x01x")) {
+		t.Errorf("CN not encoded as PrintableString: %x", der)
+	}
+}
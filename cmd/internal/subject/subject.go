@@ -3,11 +3,13 @@ package subject
 import (
 	"crypto/x509/pkix"
 	"flag"
-	"fmt"
 	"net"
+	"net/url"
 	"strings"
 
 	errgo "gopkg.in/errgo.v1"
+
+	"github.com/mhilton/ca"
 )
 
 var (
@@ -15,17 +17,34 @@ var (
 	subjectAltDNS   namesVar
 	subjectAltEmail namesVar
 	subjectAltIP    ipsVar
+	subjectAltURI   urisVar
+	spiffe          = flag.Bool("spiffe", false, "require URI subject alternative names to be valid SPIFFE IDs.")
 )
 
 func init() {
-	flag.Var(&subject, "subject", "`name` to which the certificate is issued.")
+	flag.Var(&subject, "subject", "distinguished `name` to which the certificate is issued, in RFC 4514 form, for example \"CN=example.com,O=Acme\\, Inc.,C=GB\".")
 	flag.Var(&subjectAltDNS, "subject-alt-name", "alternative `name` of the subject.")
 	flag.Var(&subjectAltEmail, "subject-alt-email", "alternative `email address` of the subject.")
 	flag.Var(&subjectAltIP, "subject-alt-ip", "alternative `IP address` of the subject.")
+	flag.Var(&subjectAltURI, "subject-alt-uri", "alternative `URI` of the subject.")
 }
 
+// Subject returns the name specified with the -subject flag.
 func Subject() pkix.Name {
-	return subject.name
+	var name pkix.Name
+	name.FillFromRDNSequence(&subject.rdns)
+	return name
+}
+
+// RawSubject returns the DER encoding of the name specified with the
+// -subject flag, with its RDNs in the order given, or nil if no name
+// was specified. It is suitable for use as the RawSubject of a
+// certificate or certificate request template.
+func RawSubject() []byte {
+	if len(subject.rdns) == 0 {
+		return nil
+	}
+	return subject.raw
 }
 
 func DNSNames() []string {
@@ -40,6 +59,19 @@ func IPAddresses() []net.IP {
 	return []net.IP(subjectAltIP)
 }
 
+func URIs() []*url.URL {
+	return []*url.URL(subjectAltURI)
+}
+
+// CheckURIs checks that the given URIs are valid SPIFFE IDs if the
+// -spiffe flag has been specified.
+func CheckURIs(uris []*url.URL) error {
+	if !*spiffe {
+		return nil
+	}
+	return ca.ValidateSPIFFEURIs(uris)
+}
+
 type namesVar []string
 
 func (v *namesVar) Set(s string) error {
@@ -74,99 +106,48 @@ func (v ipsVar) String() string {
 	return strings.Join(ss, ",")
 }
 
-type nameVar struct {
-	name pkix.Name
-}
+type urisVar []*url.URL
 
-var nameParts = map[string]func(*pkix.Name, string) error{
-	"C": func(n *pkix.Name, s string) error {
-		n.Country = append(n.Country, s)
-		return nil
-	},
-	"O": func(n *pkix.Name, s string) error {
-		n.Organization = append(n.Organization, s)
-		return nil
-	},
-	"OU": func(n *pkix.Name, s string) error {
-		n.OrganizationalUnit = append(n.OrganizationalUnit, s)
-		return nil
-	},
-	"L": func(n *pkix.Name, s string) error {
-		n.Locality = append(n.Locality, s)
-		return nil
-	},
-	"ST": func(n *pkix.Name, s string) error {
-		n.Province = append(n.Province, s)
-		return nil
-	},
-	"STREET": func(n *pkix.Name, s string) error {
-		n.StreetAddress = append(n.StreetAddress, s)
-		return nil
-	},
-	"PC": func(n *pkix.Name, s string) error {
-		n.PostalCode = append(n.PostalCode, s)
-		return nil
-	},
-	"CN": func(n *pkix.Name, s string) error {
-		if n.CommonName != "" {
-			return errgo.Newf("too many CN components")
+func (v *urisVar) Set(s string) error {
+	for _, s := range strings.Split(s, ",") {
+		u, err := url.Parse(s)
+		if err != nil {
+			return errgo.Notef(err, "invalid URI %q", s)
 		}
-		n.CommonName = s
-		return nil
-	},
-	"SERIALNUMBER": func(n *pkix.Name, s string) error {
-		if n.SerialNumber != "" {
-			return errgo.Newf("too many SERIALNUMBER components")
+		if !u.IsAbs() {
+			return errgo.Newf("invalid URI %q: not absolute", s)
 		}
-		n.SerialNumber = s
-		return nil
-	},
+		*v = append(*v, u)
+	}
+	return nil
+}
+
+func (v urisVar) String() string {
+	ss := make([]string, len(v))
+	for i, u := range v {
+		ss[i] = u.String()
+	}
+	return strings.Join(ss, ",")
+}
+
+type nameVar struct {
+	rdns pkix.RDNSequence
+	raw  []byte
 }
 
 func (v *nameVar) Set(s string) error {
-	for _, t := range strings.Split(s, ",") {
-		t := strings.TrimSpace(t)
-		i := strings.Index(t, "=")
-		if i == -1 {
-			return errgo.Newf("invalid name component %q", t)
-		}
-		if f, ok := nameParts[t[:i]]; ok {
-			f(&v.name, t[i+1:])
-			continue
-		}
-		return errgo.Newf("unrecognised name component %q", t[:i])
+	rdns, err := parseDN(s)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	raw, err := marshalDN(rdns)
+	if err != nil {
+		return errgo.Notef(err, "cannot encode name")
 	}
+	v.rdns, v.raw = rdns, raw
 	return nil
 }
 
 func (v nameVar) String() string {
-	var parts []string
-	for _, c := range v.name.Country {
-		parts = append(parts, fmt.Sprintf("C=%s", c))
-	}
-	for _, p := range v.name.Province {
-		parts = append(parts, fmt.Sprintf("ST=%s", p))
-	}
-	for _, l := range v.name.Locality {
-		parts = append(parts, fmt.Sprintf("L=%s", l))
-	}
-	for _, s := range v.name.StreetAddress {
-		parts = append(parts, fmt.Sprintf("STREET=%s", s))
-	}
-	for _, p := range v.name.PostalCode {
-		parts = append(parts, fmt.Sprintf("PC=%s", p))
-	}
-	for _, o := range v.name.Organization {
-		parts = append(parts, fmt.Sprintf("O=%s", o))
-	}
-	for _, o := range v.name.OrganizationalUnit {
-		parts = append(parts, fmt.Sprintf("OU=%s", o))
-	}
-	if v.name.CommonName != "" {
-		parts = append(parts, fmt.Sprintf("CN=%s", v.name.CommonName))
-	}
-	if v.name.SerialNumber != "" {
-		parts = append(parts, fmt.Sprintf("SERIALNUMBER=%s", v.name.SerialNumber))
-	}
-	return strings.Join(parts, ", ")
+	return formatDN(v.rdns)
 }
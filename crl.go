@@ -0,0 +1,209 @@
+package ca
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	errgo "gopkg.in/errgo.v1"
+)
+
+// revocationReasons holds the RFC 5280 names of the CRL reason codes.
+var revocationReasons = []struct {
+	name   string
+	reason int
+}{
+	{"unspecified", 0},
+	{"keyCompromise", 1},
+	{"cACompromise", 2},
+	{"affiliationChanged", 3},
+	{"superseded", 4},
+	{"cessationOfOperation", 5},
+	{"certificateHold", 6},
+	{"removeFromCRL", 8},
+	{"privilegeWithdrawn", 9},
+	{"aACompromise", 10},
+}
+
+// ParseRevocationReason parses the RFC 5280 name of a CRL reason code,
+// for example "keyCompromise". Names are not case sensitive.
+func ParseRevocationReason(s string) (int, error) {
+	for _, r := range revocationReasons {
+		if strings.EqualFold(r.name, s) {
+			return r.reason, nil
+		}
+	}
+	return 0, errgo.Newf("unknown revocation reason %q", s)
+}
+
+// RevocationReasonName returns the RFC 5280 name of a CRL reason code.
+func RevocationReasonName(reason int) string {
+	for _, r := range revocationReasons {
+		if r.reason == reason {
+			return r.name
+		}
+	}
+	return strconv.Itoa(reason)
+}
+
+func ReadCRLFile(path string) (*x509.RevocationList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot open %s", path)
+	}
+	defer f.Close()
+	crl, err := ReadCRL(f)
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot read CRL from %s", path)
+	}
+	return crl, nil
+}
+
+func ReadCRL(r io.Reader) (*x509.RevocationList, error) {
+	b, err := ReadPEM(r)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	crl, err := UnmarshalCRL(b)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	return crl, nil
+}
+
+func UnmarshalCRL(b *pem.Block) (*x509.RevocationList, error) {
+	if b.Type != "X509 CRL" {
+		return nil, errgo.Newf("unsupported CRL type %q", b.Type)
+	}
+	crl, err := x509.ParseRevocationList(b.Bytes)
+	if err != nil {
+		return nil, errgo.Notef(err, "invalid CRL")
+	}
+	return crl, nil
+}
+
+func MarshalCRL(crl *x509.RevocationList) (*pem.Block, error) {
+	if crl.Raw == nil {
+		return nil, errgo.New("invalid CRL")
+	}
+	return &pem.Block{
+		Type:  "X509 CRL",
+		Bytes: crl.Raw,
+	}, nil
+}
+
+func WriteCRL(w io.Writer, crl *x509.RevocationList) error {
+	b, err := MarshalCRL(crl)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	return WritePEM(w, b)
+}
+
+// CreateCRL creates a certificate revocation list from the given
+// template, signed by the given issuer certificate and key. If the
+// template has no ThisUpdate then the current time is used. The
+// template must have a Number, which must be greater than that of any
+// CRL previously created by the issuer.
+func CreateCRL(template *x509.RevocationList, issuer *x509.Certificate, key crypto.Signer) (*x509.RevocationList, error) {
+	t := *template
+	if t.ThisUpdate.IsZero() {
+		t.ThisUpdate = time.Now()
+	}
+	if t.NextUpdate.IsZero() {
+		return nil, errgo.New("no next update time specified")
+	}
+	if t.Number == nil {
+		return nil, errgo.New("no CRL number specified")
+	}
+	data, err := x509.CreateRevocationList(rand.Reader, &t, issuer, key)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	crl, err := x509.ParseRevocationList(data)
+	if err != nil {
+		// If we can't parse a CRL that we've just created something is very wrong.
+		panic(err)
+	}
+	return crl, nil
+}
+
+// CreateCRL creates a certificate revocation list signed by the
+// issuer. See CreateCRL for details. If the template has no Number
+// and the issuer's store is a CRLNumberStore then the number is
+// allocated by the store.
+func (i *Issuer) CreateCRL(ctx context.Context, template *x509.RevocationList) (*x509.RevocationList, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, errgo.Mask(err, errgo.Any)
+	}
+	if template.Number == nil {
+		if ns, ok := i.store.(CRLNumberStore); ok {
+			t := *template
+			var err error
+			t.Number, err = ns.NextCRLNumber(ctx, i.crt, nil)
+			if err != nil {
+				return nil, errgo.Notef(err, "cannot create CRL")
+			}
+			template = &t
+		}
+	}
+	i.mu.Lock()
+	crl, err := CreateCRL(template, i.crt, i.key)
+	i.mu.Unlock()
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot create CRL")
+	}
+	return crl, nil
+}
+
+// RevokedEntries returns the CRL entries for all the certificates in
+// the given store that were issued by issuer and have been revoked.
+func RevokedEntries(ctx context.Context, s Store, issuer *x509.Certificate) ([]x509.RevocationListEntry, error) {
+	records, err := s.Find(ctx, Query{})
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	var entries []x509.RevocationListEntry
+	for _, r := range records {
+		if !r.Revoked || !bytes.Equal(r.Certificate.RawIssuer, issuer.RawSubject) {
+			continue
+		}
+		entries = append(entries, x509.RevocationListEntry{
+			SerialNumber:   r.Certificate.SerialNumber,
+			RevocationTime: r.RevocationTime,
+			ReasonCode:     r.RevocationReason,
+		})
+	}
+	return entries, nil
+}
+
+// MergeRevocationEntries returns a new slice containing entries
+// followed by those of more whose serial numbers are not already
+// present.
+func MergeRevocationEntries(entries []x509.RevocationListEntry, more ...x509.RevocationListEntry) []x509.RevocationListEntry {
+	merged := append([]x509.RevocationListEntry(nil), entries...)
+	for _, e := range more {
+		if !containsRevocationEntry(merged, e.SerialNumber) {
+			merged = append(merged, e)
+		}
+	}
+	return merged
+}
+
+func containsRevocationEntry(entries []x509.RevocationListEntry, serial *big.Int) bool {
+	for _, e := range entries {
+		if e.SerialNumber.Cmp(serial) == 0 {
+			return true
+		}
+	}
+	return false
+}
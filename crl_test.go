@@ -0,0 +1,133 @@
+package ca
+
+import (
+	"context"
+	"crypto/elliptic"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func newTestIssuer(t *testing.T) *Issuer {
+	key, err := GenerateECDSAKey(elliptic.P256())
+	if err != nil {
+		t.Fatal(err)
+	}
+	crt, err := SelfSignCertificate(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iss, err := NewIssuer(crt, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return iss
+}
+
+func TestCreateCRLRequiresNumber(t *testing.T) {
+	iss := newTestIssuer(t)
+	_, err := iss.CreateCRL(context.Background(), &x509.RevocationList{
+		NextUpdate: time.Now().Add(time.Hour),
+	})
+	if err == nil {
+		t.Errorf("expected error creating CRL with no number")
+	}
+}
+
+func TestCreateCRLNumberFromStore(t *testing.T) {
+	ctx := context.Background()
+	iss := newTestIssuer(t)
+	s, err := NewDirStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	iss.SetStore(s)
+	now := time.Now()
+	var last *big.Int
+	for i := 0; i < 3; i++ {
+		// All the CRLs are created with the same ThisUpdate.
+		crl, err := iss.CreateCRL(ctx, &x509.RevocationList{
+			ThisUpdate: now,
+			NextUpdate: now.Add(time.Hour),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if last != nil && crl.Number.Cmp(last) <= 0 {
+			t.Errorf("CRL number %v not greater than previous %v", crl.Number, last)
+		}
+		last = crl.Number
+	}
+	crl, err := iss.CreateCRL(ctx, &x509.RevocationList{
+		Number:     big.NewInt(1000),
+		NextUpdate: now.Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if crl.Number.Int64() != 1000 {
+		t.Errorf("got CRL number %v, want 1000", crl.Number)
+	}
+}
+
+func TestNextCRLNumberMinimum(t *testing.T) {
+	ctx := context.Background()
+	iss := newTestIssuer(t)
+	s, err := NewDirStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		min  *big.Int
+		want int64
+	}{
+		{nil, 1},
+		{big.NewInt(41), 42},
+		{nil, 43},
+		{big.NewInt(10), 44},
+	}
+	for _, test := range tests {
+		n, err := s.NextCRLNumber(ctx, iss.Certificate(), test.min)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n.Int64() != test.want {
+			t.Errorf("NextCRLNumber(%v): got %v, want %d", test.min, n, test.want)
+		}
+	}
+}
+
+func TestMergeRevocationEntries(t *testing.T) {
+	entries := []x509.RevocationListEntry{
+		{SerialNumber: big.NewInt(1), ReasonCode: 1},
+		{SerialNumber: big.NewInt(2), ReasonCode: 1},
+	}
+	merged := MergeRevocationEntries(entries,
+		x509.RevocationListEntry{SerialNumber: big.NewInt(2), ReasonCode: 4},
+		x509.RevocationListEntry{SerialNumber: big.NewInt(3), ReasonCode: 4},
+	)
+	want := []struct {
+		serial int64
+		reason int
+	}{{1, 1}, {2, 1}, {3, 4}}
+	if len(merged) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(merged), len(want))
+	}
+	for i, w := range want {
+		if merged[i].SerialNumber.Int64() != w.serial || merged[i].ReasonCode != w.reason {
+			t.Errorf("entry %d: got serial %v reason %d, want serial %d reason %d", i, merged[i].SerialNumber, merged[i].ReasonCode, w.serial, w.reason)
+		}
+	}
+	if len(entries) != 2 {
+		t.Errorf("entries modified")
+	}
+}
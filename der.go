@@ -0,0 +1,89 @@
+package ca
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+
+	errgo "gopkg.in/errgo.v1"
+)
+
+// derTypes holds the PEM block types that DERBlock can detect, in the
+// order in which they are tried, along with a function that checks
+// whether DER data is of that type.
+var derTypes = []struct {
+	typ   string
+	check func([]byte) error
+}{{
+	typ:   "CERTIFICATE",
+	check: func(data []byte) error { _, err := x509.ParseCertificate(data); return err },
+}, {
+	typ:   "CERTIFICATE REQUEST",
+	check: func(data []byte) error { _, err := x509.ParseCertificateRequest(data); return err },
+}, {
+	typ:   "X509 CRL",
+	check: func(data []byte) error { _, err := x509.ParseRevocationList(data); return err },
+}, {
+	typ:   "PRIVATE KEY",
+	check: func(data []byte) error { _, err := x509.ParsePKCS8PrivateKey(data); return err },
+}, {
+	typ:   "RSA PRIVATE KEY",
+	check: func(data []byte) error { _, err := x509.ParsePKCS1PrivateKey(data); return err },
+}, {
+	typ:   "EC PRIVATE KEY",
+	check: func(data []byte) error { _, err := x509.ParseECPrivateKey(data); return err },
+}, {
+	typ: "ENCRYPTED PRIVATE KEY",
+	check: func(data []byte) error {
+		var epki encryptedPrivateKeyInfo
+		return unmarshalDER(data, &epki)
+	},
+}}
+
+// DERBlock determines the type of the given DER encoded data and
+// returns it in a PEM block of the corresponding type. Certificates,
+// certificate signing requests, CRLs and private keys in PKCS#1, SEC 1
+// and (possibly encrypted) PKCS#8 formats are recognised.
+func DERBlock(data []byte) (*pem.Block, error) {
+	for _, t := range derTypes {
+		if t.check(data) == nil {
+			return &pem.Block{
+				Type:  t.typ,
+				Bytes: data,
+			}, nil
+		}
+	}
+	return nil, errgo.New("invalid PEM or DER data")
+}
+
+// derBlocks is like DERBlock but also recognises a sequence of
+// concatenated DER certificates.
+func derBlocks(data []byte) ([]*pem.Block, error) {
+	b, err := DERBlock(data)
+	if err == nil {
+		return []*pem.Block{b}, nil
+	}
+	crts, err := x509.ParseCertificates(data)
+	if err != nil || len(crts) == 0 {
+		return nil, errgo.New("invalid PEM or DER data")
+	}
+	bs := make([]*pem.Block, len(crts))
+	for i, crt := range crts {
+		bs[i] = &pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: crt.Raw,
+		}
+	}
+	return bs, nil
+}
+
+// WriteDER writes the contents of b as raw DER. Blocks with headers,
+// such as those encrypted with a LegacyCipher, cannot be written as
+// DER.
+func WriteDER(w io.Writer, b *pem.Block) error {
+	if len(b.Headers) > 0 {
+		return errgo.Newf("cannot write %s with headers as DER", b.Type)
+	}
+	_, err := w.Write(b.Bytes)
+	return errgo.Mask(err)
+}
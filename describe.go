@@ -0,0 +1,376 @@
+package ca
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	errgo "gopkg.in/errgo.v1"
+)
+
+// A Description holds the human readable details of a certificate,
+// certificate signing request, CRL or private key. It is suitable for
+// encoding as JSON.
+type Description struct {
+	// Type is the type of object described, one of "certificate",
+	// "certificate request", "CRL", "private key" or "encrypted
+	// private key". Only the Type of an encrypted private key is
+	// described.
+	Type string `json:"type"`
+
+	Subject            string            `json:"subject,omitempty"`
+	Issuer             string            `json:"issuer,omitempty"`
+	SerialNumber       string            `json:"serial-number,omitempty"`
+	NotBefore          *time.Time        `json:"not-before,omitempty"`
+	NotAfter           *time.Time        `json:"not-after,omitempty"`
+	ThisUpdate         *time.Time        `json:"this-update,omitempty"`
+	NextUpdate         *time.Time        `json:"next-update,omitempty"`
+	CRLNumber          string            `json:"crl-number,omitempty"`
+	IsCA               *bool             `json:"is-ca,omitempty"`
+	MaxPathLen         *int              `json:"max-path-len,omitempty"`
+	DNSNames           []string          `json:"dns-names,omitempty"`
+	EmailAddresses     []string          `json:"email-addresses,omitempty"`
+	IPAddresses        []string          `json:"ip-addresses,omitempty"`
+	URIs               []string          `json:"uris,omitempty"`
+	KeyUsage           []string          `json:"key-usage,omitempty"`
+	ExtKeyUsage        []string          `json:"ext-key-usage,omitempty"`
+	SubjectKeyID       string            `json:"subject-key-id,omitempty"`
+	AuthorityKeyID     string            `json:"authority-key-id,omitempty"`
+	Extensions         []ExtensionInfo   `json:"extensions,omitempty"`
+	Revoked            []RevocationInfo  `json:"revoked,omitempty"`
+	SignatureAlgorithm string            `json:"signature-algorithm,omitempty"`
+	PublicKey          *KeyInfo          `json:"public-key,omitempty"`
+	Fingerprints       map[string]string `json:"fingerprints,omitempty"`
+}
+
+// ExtensionInfo describes an extension.
+type ExtensionInfo struct {
+	OID      string `json:"oid"`
+	Name     string `json:"name,omitempty"`
+	Critical bool   `json:"critical,omitempty"`
+}
+
+// RevocationInfo describes an entry in a CRL.
+type RevocationInfo struct {
+	SerialNumber   string    `json:"serial-number"`
+	RevocationTime time.Time `json:"revocation-time"`
+	Reason         string    `json:"reason,omitempty"`
+}
+
+// KeyInfo describes a public key.
+type KeyInfo struct {
+	Algorithm string `json:"algorithm"`
+	Bits      int    `json:"bits,omitempty"`
+	Curve     string `json:"curve,omitempty"`
+
+	// Fingerprint holds the SHA-256 hash of the DER encoded
+	// subject public key info.
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+var extensionNames = map[string]string{
+	"2.5.29.14":               "subjectKeyIdentifier",
+	"2.5.29.15":               "keyUsage",
+	"2.5.29.17":               "subjectAltName",
+	"2.5.29.18":               "issuerAltName",
+	"2.5.29.19":               "basicConstraints",
+	"2.5.29.20":               "cRLNumber",
+	"2.5.29.21":               "reasonCode",
+	"2.5.29.27":               "deltaCRLIndicator",
+	"2.5.29.28":               "issuingDistributionPoint",
+	"2.5.29.30":               "nameConstraints",
+	"2.5.29.31":               "cRLDistributionPoints",
+	"2.5.29.32":               "certificatePolicies",
+	"2.5.29.35":               "authorityKeyIdentifier",
+	"2.5.29.37":               "extKeyUsage",
+	"1.3.6.1.5.5.7.1.1":       "authorityInfoAccess",
+	"1.3.6.1.5.5.7.1.24":      "tlsFeature",
+	"1.3.6.1.4.1.11129.2.4.2": "signedCertificateTimestampList",
+	"1.3.6.1.4.1.11129.2.4.3": "precertificatePoison",
+}
+
+// Describe describes the object held in b, which may be a
+// certificate, certificate signing request, CRL or private key.
+func Describe(b *pem.Block) (*Description, error) {
+	switch b.Type {
+	case "CERTIFICATE":
+		crt, err := UnmarshalCertificate(b)
+		if err != nil {
+			return nil, errgo.Mask(err)
+		}
+		return DescribeCertificate(crt), nil
+	case "CERTIFICATE REQUEST":
+		csr, err := UnmarshalCertificateRequest(b)
+		if err != nil {
+			return nil, errgo.Mask(err)
+		}
+		return DescribeCertificateRequest(csr), nil
+	case "X509 CRL":
+		crl, err := UnmarshalCRL(b)
+		if err != nil {
+			return nil, errgo.Mask(err)
+		}
+		return DescribeCRL(crl), nil
+	}
+	if IsEncryptedPEMBlock(b) {
+		return &Description{Type: "encrypted private key"}, nil
+	}
+	key, err := UnmarshalKey(b)
+	if err != nil {
+		return nil, errgo.Newf("unsupported type %q", b.Type)
+	}
+	return &Description{
+		Type:      "private key",
+		PublicKey: describeKey(key.Public()),
+	}, nil
+}
+
+// DescribeCertificate describes a certificate.
+func DescribeCertificate(crt *x509.Certificate) *Description {
+	d := &Description{
+		Type:               "certificate",
+		Subject:            crt.Subject.String(),
+		Issuer:             crt.Issuer.String(),
+		SerialNumber:       formatSerial(crt.SerialNumber),
+		NotBefore:          &crt.NotBefore,
+		NotAfter:           &crt.NotAfter,
+		KeyUsage:           KeyUsageNames(crt.KeyUsage),
+		SubjectKeyID:       formatHex(crt.SubjectKeyId),
+		AuthorityKeyID:     formatHex(crt.AuthorityKeyId),
+		SignatureAlgorithm: crt.SignatureAlgorithm.String(),
+		PublicKey:          describeKey(crt.PublicKey),
+		Fingerprints:       fingerprints(crt.Raw),
+	}
+	d.setSANs(crt.DNSNames, crt.EmailAddresses, crt.IPAddresses, crt.URIs)
+	if crt.BasicConstraintsValid {
+		d.IsCA = &crt.IsCA
+		if crt.IsCA && (crt.MaxPathLen > 0 || crt.MaxPathLenZero) {
+			d.MaxPathLen = &crt.MaxPathLen
+		}
+	}
+	for _, u := range crt.ExtKeyUsage {
+		d.ExtKeyUsage = append(d.ExtKeyUsage, ExtKeyUsageName(u))
+	}
+	for _, oid := range crt.UnknownExtKeyUsage {
+		d.ExtKeyUsage = append(d.ExtKeyUsage, oid.String())
+	}
+	d.Extensions = describeExtensions(crt.Extensions)
+	return d
+}
+
+// DescribeCertificateRequest describes a certificate signing request.
+func DescribeCertificateRequest(csr *x509.CertificateRequest) *Description {
+	d := &Description{
+		Type:               "certificate request",
+		Subject:            csr.Subject.String(),
+		SignatureAlgorithm: csr.SignatureAlgorithm.String(),
+		PublicKey:          describeKey(csr.PublicKey),
+	}
+	d.setSANs(csr.DNSNames, csr.EmailAddresses, csr.IPAddresses, csr.URIs)
+	d.Extensions = describeExtensions(csr.Extensions)
+	return d
+}
+
+// DescribeCRL describes a certificate revocation list.
+func DescribeCRL(crl *x509.RevocationList) *Description {
+	d := &Description{
+		Type:               "CRL",
+		Issuer:             crl.Issuer.String(),
+		ThisUpdate:         &crl.ThisUpdate,
+		AuthorityKeyID:     formatHex(crl.AuthorityKeyId),
+		SignatureAlgorithm: crl.SignatureAlgorithm.String(),
+		Fingerprints:       fingerprints(crl.Raw),
+	}
+	if !crl.NextUpdate.IsZero() {
+		d.NextUpdate = &crl.NextUpdate
+	}
+	if crl.Number != nil {
+		d.CRLNumber = crl.Number.String()
+	}
+	for _, e := range crl.RevokedCertificateEntries {
+		d.Revoked = append(d.Revoked, RevocationInfo{
+			SerialNumber:   formatSerial(e.SerialNumber),
+			RevocationTime: e.RevocationTime,
+			Reason:         RevocationReasonName(e.ReasonCode),
+		})
+	}
+	d.Extensions = describeExtensions(crl.Extensions)
+	return d
+}
+
+func (d *Description) setSANs(dnsNames, emailAddresses []string, ips []net.IP, uris []*url.URL) {
+	d.DNSNames = dnsNames
+	d.EmailAddresses = emailAddresses
+	for _, ip := range ips {
+		d.IPAddresses = append(d.IPAddresses, ip.String())
+	}
+	for _, u := range uris {
+		d.URIs = append(d.URIs, u.String())
+	}
+}
+
+func describeExtensions(exts []pkix.Extension) []ExtensionInfo {
+	var infos []ExtensionInfo
+	for _, ext := range exts {
+		infos = append(infos, ExtensionInfo{
+			OID:      ext.Id.String(),
+			Name:     extensionNames[ext.Id.String()],
+			Critical: ext.Critical,
+		})
+	}
+	return infos
+}
+
+func describeKey(pub crypto.PublicKey) *KeyInfo {
+	var info KeyInfo
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		info.Algorithm = "RSA"
+		info.Bits = k.N.BitLen()
+	case *ecdsa.PublicKey:
+		info.Algorithm = "ECDSA"
+		info.Bits = k.Curve.Params().BitSize
+		info.Curve = k.Curve.Params().Name
+	case ed25519.PublicKey:
+		info.Algorithm = "Ed25519"
+		info.Bits = 256
+	default:
+		info.Algorithm = fmt.Sprintf("%T", pub)
+	}
+	if data, err := x509.MarshalPKIXPublicKey(pub); err == nil {
+		sum := sha256.Sum256(data)
+		info.Fingerprint = formatHex(sum[:])
+	}
+	return &info
+}
+
+func fingerprints(data []byte) map[string]string {
+	sum1 := sha1.Sum(data)
+	sum256 := sha256.Sum256(data)
+	return map[string]string{
+		"sha1":   formatHex(sum1[:]),
+		"sha256": formatHex(sum256[:]),
+	}
+}
+
+func formatSerial(n *big.Int) string {
+	if n == nil {
+		return ""
+	}
+	return fmt.Sprintf("0x%X", n)
+}
+
+// formatHex formats data as colon separated hexadecimal bytes.
+func formatHex(data []byte) string {
+	ss := make([]string, len(data))
+	for i, b := range data {
+		ss[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(ss, ":")
+}
+
+// WriteText writes d to w in a human readable form.
+func (d *Description) WriteText(w io.Writer) error {
+	tw := &textWriter{w: w}
+	tw.field("Type", d.Type)
+	tw.field("Subject", d.Subject)
+	tw.field("Issuer", d.Issuer)
+	tw.field("Serial Number", d.SerialNumber)
+	tw.time("Not Before", d.NotBefore)
+	tw.time("Not After", d.NotAfter)
+	tw.time("This Update", d.ThisUpdate)
+	tw.time("Next Update", d.NextUpdate)
+	tw.field("CRL Number", d.CRLNumber)
+	if d.IsCA != nil {
+		tw.field("CA", fmt.Sprint(*d.IsCA))
+	}
+	if d.MaxPathLen != nil {
+		tw.field("Max Path Length", fmt.Sprint(*d.MaxPathLen))
+	}
+	tw.list("DNS Names", d.DNSNames)
+	tw.list("Email Addresses", d.EmailAddresses)
+	tw.list("IP Addresses", d.IPAddresses)
+	tw.list("URIs", d.URIs)
+	tw.field("Key Usage", strings.Join(d.KeyUsage, ", "))
+	tw.field("Extended Key Usage", strings.Join(d.ExtKeyUsage, ", "))
+	tw.field("Subject Key ID", d.SubjectKeyID)
+	tw.field("Authority Key ID", d.AuthorityKeyID)
+	if len(d.Extensions) > 0 {
+		tw.printf("Extensions:\n")
+		for _, ext := range d.Extensions {
+			name := ext.OID
+			if ext.Name != "" {
+				name = ext.Name + " (" + ext.OID + ")"
+			}
+			if ext.Critical {
+				name += " critical"
+			}
+			tw.printf("    %s\n", name)
+		}
+	}
+	if len(d.Revoked) > 0 {
+		tw.printf("Revoked Certificates:\n")
+		for _, r := range d.Revoked {
+			tw.printf("    %s %s %s\n", r.SerialNumber, r.RevocationTime.UTC().Format(time.RFC3339), r.Reason)
+		}
+	}
+	tw.field("Signature Algorithm", d.SignatureAlgorithm)
+	if k := d.PublicKey; k != nil {
+		s := k.Algorithm
+		if k.Bits > 0 {
+			s += fmt.Sprintf(" %d bit", k.Bits)
+		}
+		if k.Curve != "" {
+			s += " " + k.Curve
+		}
+		tw.field("Public Key", s)
+		tw.field("Public Key SHA-256", k.Fingerprint)
+	}
+	if d.Fingerprints != nil {
+		tw.field("SHA-1 Fingerprint", d.Fingerprints["sha1"])
+		tw.field("SHA-256 Fingerprint", d.Fingerprints["sha256"])
+	}
+	return tw.err
+}
+
+// textWriter writes the fields of a Description, recording the first
+// error encountered.
+type textWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (tw *textWriter) printf(format string, args ...interface{}) {
+	if tw.err == nil {
+		_, tw.err = fmt.Fprintf(tw.w, format, args...)
+	}
+}
+
+func (tw *textWriter) field(name, value string) {
+	if value != "" {
+		tw.printf("%s: %s\n", name, value)
+	}
+}
+
+func (tw *textWriter) time(name string, t *time.Time) {
+	if t != nil {
+		tw.field(name, t.UTC().Format(time.RFC3339))
+	}
+}
+
+func (tw *textWriter) list(name string, values []string) {
+	tw.field(name, strings.Join(values, ", "))
+}
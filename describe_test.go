@@ -0,0 +1,201 @@
+package ca
+
+import (
+	"bytes"
+	"context"
+	"crypto/elliptic"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDescribe(t *testing.T) {
+	ctx := context.Background()
+	iss := newTestIssuer(t)
+	key, err := GenerateECDSAKey(elliptic.P384())
+	if err != nil {
+		t.Fatal(err)
+	}
+	crt, err := iss.IssueFor(ctx, key.Public(), &x509.Certificate{
+		SerialNumber: big.NewInt(0x1234),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		DNSNames:     []string{"example.com"},
+		IPAddresses:  []net.IP{net.ParseIP("192.0.2.1")},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	crtBlock, err := MarshalCertificate(crt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := SignCertificateRequest(&x509.CertificateRequest{
+		Subject:        pkix.Name{CommonName: "example.org"},
+		EmailAddresses: []string{"admin@example.org"},
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csrBlock, err := MarshalCertificateRequest(csr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revokedAt := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	crl, err := iss.CreateCRL(ctx, &x509.RevocationList{
+		Number:     big.NewInt(7),
+		ThisUpdate: time.Now(),
+		NextUpdate: time.Now().Add(time.Hour),
+		RevokedCertificateEntries: []x509.RevocationListEntry{{
+			SerialNumber:   big.NewInt(0x1234),
+			RevocationTime: revokedAt,
+			ReasonCode:     1,
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	crlBlock, err := MarshalCRL(crl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyBlock, err := MarshalKey(key, KeyFormatPKCS8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encBlock, err := EncryptPEMBlock(ctx, keyBlock, testPassphrase("secret"), PBES2Cipher{Cipher: AES256CBC, KDF: PBKDF2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		about    string
+		block    *pem.Block
+		wantType string
+		wantText []string
+		wantJSON map[string]interface{}
+	}{{
+		about:    "certificate",
+		block:    crtBlock,
+		wantType: "certificate",
+		wantText: []string{
+			"Subject: CN=example.com\n",
+			"Issuer: CN=test CA\n",
+			"Serial Number: 0x1234\n",
+			"192.0.2.1",
+			"serverAuth",
+			"subjectAltName (2.5.29.17)",
+			"Public Key: ECDSA 384 bit P-384\n",
+			"SHA-256 Fingerprint: ",
+		},
+		wantJSON: map[string]interface{}{
+			"type":          "certificate",
+			"subject":       "CN=example.com",
+			"serial-number": "0x1234",
+			"dns-names":     []interface{}{"example.com"},
+		},
+	}, {
+		about:    "certificate request",
+		block:    csrBlock,
+		wantType: "certificate request",
+		wantText: []string{
+			"Subject: CN=example.org\n",
+			"admin@example.org",
+			"Signature Algorithm: ECDSA-SHA384\n",
+		},
+		wantJSON: map[string]interface{}{
+			"type":            "certificate request",
+			"email-addresses": []interface{}{"admin@example.org"},
+		},
+	}, {
+		about:    "CRL",
+		block:    crlBlock,
+		wantType: "CRL",
+		wantText: []string{
+			"Issuer: CN=test CA\n",
+			"CRL Number: 7\n",
+			"Revoked Certificates:\n    0x1234 2020-01-02T03:04:05Z keyCompromise\n",
+		},
+		wantJSON: map[string]interface{}{
+			"type":       "CRL",
+			"crl-number": "7",
+			"revoked": []interface{}{map[string]interface{}{
+				"serial-number":   "0x1234",
+				"revocation-time": "2020-01-02T03:04:05Z",
+				"reason":          "keyCompromise",
+			}},
+		},
+	}, {
+		about:    "private key",
+		block:    keyBlock,
+		wantType: "private key",
+		wantText: []string{"Public Key: ECDSA 384 bit P-384\n"},
+		wantJSON: map[string]interface{}{
+			"type": "private key",
+			"public-key": map[string]interface{}{
+				"algorithm":   "ECDSA",
+				"bits":        float64(384),
+				"curve":       "P-384",
+				"fingerprint": DescribeCertificate(crt).PublicKey.Fingerprint,
+			},
+		},
+	}, {
+		about:    "encrypted private key",
+		block:    encBlock,
+		wantType: "encrypted private key",
+		wantText: []string{"Type: encrypted private key\n"},
+		wantJSON: map[string]interface{}{
+			"type": "encrypted private key",
+		},
+	}}
+	for _, test := range tests {
+		t.Run(test.about, func(t *testing.T) {
+			d, err := Describe(test.block)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d.Type != test.wantType {
+				t.Errorf("got type %q, want %q", d.Type, test.wantType)
+			}
+			var buf bytes.Buffer
+			if err := d.WriteText(&buf); err != nil {
+				t.Fatal(err)
+			}
+			for _, s := range test.wantText {
+				if !strings.Contains(buf.String(), s) {
+					t.Errorf("text does not contain %q:\n%s", s, buf.String())
+				}
+			}
+			data, err := json.Marshal(d)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got map[string]interface{}
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatal(err)
+			}
+			for k, want := range test.wantJSON {
+				gotJSON, _ := json.Marshal(got[k])
+				wantJSON, _ := json.Marshal(want)
+				if !bytes.Equal(gotJSON, wantJSON) {
+					t.Errorf("got %s %s, want %s", k, gotJSON, wantJSON)
+				}
+			}
+		})
+	}
+}
+
+func TestDescribeUnsupportedType(t *testing.T) {
+	if _, err := Describe(&pem.Block{Type: "SOMETHING ELSE"}); err == nil {
+		t.Errorf("expected error describing unsupported type")
+	}
+}
@@ -0,0 +1,230 @@
+package ca
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	errgo "gopkg.in/errgo.v1"
+)
+
+// A DirStore is a Store that keeps its records in a directory. The
+// directory contains:
+//
+//	certs/<serial>.pem          each issued certificate
+//	revoked/<serial>.json       the revocation details of revoked certificates
+//	crlnumbers/<issuer>/<number> the last CRL number allocated for each CRL issuer
+//
+// where <serial> is the serial number of the certificate in upper case
+// hexadecimal, <issuer> is derived from the CRL issuer's name and
+// <number> is a CRL number in decimal.
+type DirStore struct {
+	dir string
+}
+
+// NewDirStore creates a DirStore using the given directory, creating
+// it if necessary.
+func NewDirStore(dir string) (*DirStore, error) {
+	for _, d := range []string{"certs", "revoked", "crlnumbers"} {
+		if err := os.MkdirAll(filepath.Join(dir, d), 0700); err != nil {
+			return nil, errgo.Notef(err, "cannot create store")
+		}
+	}
+	return &DirStore{dir: dir}, nil
+}
+
+type revocationJSON struct {
+	Time   time.Time `json:"time"`
+	Reason int       `json:"reason"`
+}
+
+// Add implements Store.Add.
+func (s *DirStore) Add(_ context.Context, crt *x509.Certificate) error {
+	f, err := ioutil.TempFile(s.dir, ".tmp")
+	if err != nil {
+		return errgo.Notef(err, "cannot create temporary file")
+	}
+	defer os.Remove(f.Name())
+	err = WriteCertificate(f, crt)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return errgo.Notef(err, "cannot write certificate")
+	}
+	// Linking fails if the target exists, which guarantees serial
+	// numbers are unique even with concurrent writers.
+	if err := os.Link(f.Name(), s.certPath(crt.SerialNumber)); err != nil {
+		if os.IsExist(err) {
+			return errgo.WithCausef(nil, ErrDuplicate, "certificate with serial number %X already exists", crt.SerialNumber)
+		}
+		return errgo.Notef(err, "cannot add certificate")
+	}
+	return nil
+}
+
+// Get implements Store.Get.
+func (s *DirStore) Get(_ context.Context, serial *big.Int) (*Record, error) {
+	f, err := os.Open(s.certPath(serial))
+	if os.IsNotExist(err) {
+		return nil, errgo.WithCausef(nil, ErrNotFound, "certificate with serial number %X not found", serial)
+	}
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	defer f.Close()
+	crt, err := ReadCertificate(f)
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot read certificate %X", serial)
+	}
+	return s.record(crt)
+}
+
+// Find implements Store.Find.
+func (s *DirStore) Find(ctx context.Context, q Query) ([]*Record, error) {
+	infos, err := ioutil.ReadDir(filepath.Join(s.dir, "certs"))
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot read store")
+	}
+	var records []*Record
+	for _, info := range infos {
+		if !strings.HasSuffix(info.Name(), ".pem") {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, errgo.Mask(err, errgo.Any)
+		}
+		crt, err := ReadCertificateFile(filepath.Join(s.dir, "certs", info.Name()))
+		if err != nil {
+			return nil, errgo.Mask(err)
+		}
+		if !q.Match(crt) {
+			continue
+		}
+		r, err := s.record(crt)
+		if err != nil {
+			return nil, errgo.Mask(err)
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+// Revoke implements Store.Revoke.
+func (s *DirStore) Revoke(ctx context.Context, serial *big.Int, t time.Time, reason int) error {
+	if _, err := os.Stat(s.certPath(serial)); err != nil {
+		if os.IsNotExist(err) {
+			return errgo.WithCausef(nil, ErrNotFound, "certificate with serial number %X not found", serial)
+		}
+		return errgo.Mask(err)
+	}
+	data, err := json.Marshal(revocationJSON{
+		Time:   t.UTC(),
+		Reason: reason,
+	})
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	f, err := ioutil.TempFile(s.dir, ".tmp")
+	if err != nil {
+		return errgo.Notef(err, "cannot create temporary file")
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return errgo.Notef(err, "cannot write revocation")
+	}
+	// Linking fails if the certificate has already been revoked,
+	// so that the first revocation is never overwritten.
+	if err := os.Link(f.Name(), s.revokedPath(serial)); err != nil {
+		if os.IsExist(err) {
+			return errgo.WithCausef(nil, ErrRevoked, "certificate with serial number %X already revoked", serial)
+		}
+		return errgo.Notef(err, "cannot revoke certificate")
+	}
+	return nil
+}
+
+// NextCRLNumber implements CRLNumberStore.NextCRLNumber.
+func (s *DirStore) NextCRLNumber(_ context.Context, issuer *x509.Certificate, min *big.Int) (*big.Int, error) {
+	sum := sha256.Sum256(issuer.RawSubject)
+	dir := filepath.Join(s.dir, "crlnumbers", hex.EncodeToString(sum[:16]))
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errgo.Notef(err, "cannot create CRL number directory")
+	}
+	for {
+		names, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return nil, errgo.Notef(err, "cannot read CRL numbers")
+		}
+		last := new(big.Int)
+		for _, info := range names {
+			n, ok := new(big.Int).SetString(info.Name(), 10)
+			if ok && n.Cmp(last) > 0 {
+				last = n
+			}
+		}
+		next := new(big.Int).Add(last, big.NewInt(1))
+		if min != nil && min.Cmp(last) > 0 {
+			next.Add(min, big.NewInt(1))
+		}
+		// Creating the file fails if another writer has already
+		// allocated the number, in which case try again.
+		f, err := os.OpenFile(filepath.Join(dir, next.String()), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, errgo.Notef(err, "cannot allocate CRL number")
+		}
+		f.Close()
+		if last.Sign() > 0 {
+			os.Remove(filepath.Join(dir, last.String()))
+		}
+		return next, nil
+	}
+}
+
+func (s *DirStore) record(crt *x509.Certificate) (*Record, error) {
+	r := &Record{
+		Certificate: crt,
+	}
+	data, err := ioutil.ReadFile(s.revokedPath(crt.SerialNumber))
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot read revocation")
+	}
+	var rev revocationJSON
+	if err := json.Unmarshal(data, &rev); err != nil {
+		return nil, errgo.Notef(err, "cannot read revocation")
+	}
+	r.Revoked = true
+	r.RevocationTime = rev.Time
+	r.RevocationReason = rev.Reason
+	return r, nil
+}
+
+func (s *DirStore) certPath(serial *big.Int) string {
+	return filepath.Join(s.dir, "certs", serialName(serial)+".pem")
+}
+
+func (s *DirStore) revokedPath(serial *big.Int) string {
+	return filepath.Join(s.dir, "revoked", serialName(serial)+".json")
+}
+
+func serialName(serial *big.Int) string {
+	return strings.ToUpper(serial.Text(16))
+}
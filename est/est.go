@@ -0,0 +1,279 @@
+// Package est implements an RFC 7030 Enrollment over Secure Transport
+// server that issues certificates using a ca.Issuer.
+//
+// The server supports the /cacerts, /simpleenroll and /simplereenroll
+// operations below /.well-known/est/. Clients enrolling for a new
+// certificate must authenticate either with HTTP basic authentication
+// or with a verified TLS client certificate. A client that
+// authenticates only with a certificate may only enroll for the
+// subject and subject alternative names of that certificate. Clients
+// renewing a certificate must present the certificate being renewed as
+// their TLS client certificate.
+package est
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	errgo "gopkg.in/errgo.v1"
+
+	"github.com/mhilton/ca"
+)
+
+// maxRequestSize is the maximum size of a request body that will be
+// read.
+const maxRequestSize = 64 * 1024
+
+// pathPrefix is the prefix of all EST operation paths.
+const pathPrefix = "/.well-known/est/"
+
+// Params holds the parameters for a Server.
+type Params struct {
+	// Issuer is used to issue certificates.
+	Issuer *ca.Issuer
+
+	// Profile is the profile of issued certificates.
+	Profile *ca.Profile
+
+	// Users holds the passwords of users that may enroll using HTTP
+	// basic authentication, keyed by username.
+	Users map[string]string
+
+	// Store, if set, holds the certificates issued by Issuer. Client
+	// certificates issued by Issuer that have been revoked in the
+	// store are rejected.
+	Store ca.Store
+}
+
+// A Server is an http.Handler that implements an EST server. For TLS
+// client certificate authentication the server must be run with a TLS
+// configuration that verifies client certificates.
+type Server struct {
+	p Params
+}
+
+// New creates a new EST server.
+func New(p Params) (*Server, error) {
+	if p.Issuer == nil || p.Profile == nil {
+		return nil, errgo.New("issuer and profile must be specified")
+	}
+	return &Server{p: p}, nil
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if !strings.HasPrefix(req.URL.Path, pathPrefix) {
+		http.NotFound(w, req)
+		return
+	}
+	switch op := strings.TrimPrefix(req.URL.Path, pathPrefix); op {
+	case "cacerts":
+		if req.Method != "GET" {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.writeCertificates(w, s.p.Issuer.Chain())
+	case "simpleenroll", "simplereenroll":
+		if req.Method != "POST" {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.serveEnroll(w, req, op == "simplereenroll")
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+func (s *Server) serveEnroll(w http.ResponseWriter, req *http.Request, reenroll bool) {
+	var clientCrt *x509.Certificate
+	if req.TLS != nil && len(req.TLS.VerifiedChains) > 0 {
+		clientCrt = req.TLS.VerifiedChains[0][0]
+	}
+	// A client authenticated only by its certificate is bound to
+	// the names in that certificate, as is any re-enrollment.
+	bound := reenroll || !s.checkPassword(req)
+	switch {
+	case reenroll && clientCrt == nil:
+		http.Error(w, "re-enrollment requires a client certificate", http.StatusUnauthorized)
+		return
+	case bound && clientCrt == nil:
+		w.Header().Set("WWW-Authenticate", `Basic realm="est"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if bound {
+		if err := s.checkRevoked(req.Context(), clientCrt); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+	}
+	if ct := req.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/pkcs10") {
+		http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, req.Body, maxRequestSize))
+	if err != nil {
+		http.Error(w, "cannot read request", http.StatusBadRequest)
+		return
+	}
+	der, err := decodeBase64(body)
+	if err != nil {
+		http.Error(w, "invalid request encoding", http.StatusBadRequest)
+		return
+	}
+	csr, err := ca.UnmarshalCertificateRequest(&pem.Block{
+		Type:  "CERTIFICATE REQUEST",
+		Bytes: der,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if bound {
+		if err := checkNames(csr, clientCrt); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	crt, err := s.p.Issuer.Issue(req.Context(), csr, s.p.Profile)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.writeCertificates(w, []*x509.Certificate{crt})
+}
+
+// checkPassword checks the HTTP basic authentication credentials in
+// the request.
+func (s *Server) checkPassword(req *http.Request) bool {
+	user, password, ok := req.BasicAuth()
+	if !ok {
+		return false
+	}
+	want, ok := s.p.Users[user]
+	if !ok {
+		return false
+	}
+	// Compare hashes so that the comparison takes the same time
+	// whatever the length of the password.
+	h1 := sha256.Sum256([]byte(password))
+	h2 := sha256.Sum256([]byte(want))
+	return subtle.ConstantTimeCompare(h1[:], h2[:]) == 1
+}
+
+// checkRevoked returns an error if crt was issued by the server's
+// issuer and has been revoked in the store.
+func (s *Server) checkRevoked(ctx context.Context, crt *x509.Certificate) error {
+	if s.p.Store == nil || !bytes.Equal(crt.RawIssuer, s.p.Issuer.Certificate().RawSubject) {
+		return nil
+	}
+	rec, err := s.p.Store.Get(ctx, crt.SerialNumber)
+	if errgo.Cause(err) == ca.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	if rec.Revoked {
+		return errgo.New("client certificate has been revoked")
+	}
+	return nil
+}
+
+// checkNames checks that a request is for the same subject and subject
+// alternative names as the client certificate, as required for
+// re-enrollment (RFC 7030 section 4.2.2).
+func checkNames(csr *x509.CertificateRequest, crt *x509.Certificate) error {
+	// Compare the string forms of the subjects as the issued
+	// certificate may use different string types to the request.
+	if csr.Subject.String() != crt.Subject.String() {
+		return errgo.New("subject does not match current certificate")
+	}
+	if !equalStrings(csr.DNSNames, crt.DNSNames) ||
+		!equalStrings(csr.EmailAddresses, crt.EmailAddresses) ||
+		!equalStrings(ipStrings(csr.IPAddresses), ipStrings(crt.IPAddresses)) ||
+		!equalStrings(uriStrings(csr.URIs), uriStrings(crt.URIs)) {
+		return errgo.New("subject alternative names do not match current certificate")
+	}
+	return nil
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func ipStrings(ips []net.IP) []string {
+	ss := make([]string, len(ips))
+	for i, ip := range ips {
+		ss[i] = ip.String()
+	}
+	return ss
+}
+
+func uriStrings(uris []*url.URL) []string {
+	ss := make([]string, len(uris))
+	for i, u := range uris {
+		ss[i] = u.String()
+	}
+	return ss
+}
+
+func (s *Server) writeCertificates(w http.ResponseWriter, crts []*x509.Certificate) {
+	data, err := marshalCertsOnly(crts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/pkcs7-mime; smime-type=certs-only")
+	w.Header().Set("Content-Transfer-Encoding", "base64")
+	w.Write(encodeBase64(data))
+}
+
+// decodeBase64 decodes base64 data that may contain line breaks.
+func decodeBase64(data []byte) ([]byte, error) {
+	data = bytes.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', '\r', '\n':
+			return -1
+		}
+		return r
+	}, data)
+	der := make([]byte, base64.StdEncoding.DecodedLen(len(data)))
+	n, err := base64.StdEncoding.Decode(der, data)
+	if err != nil {
+		return nil, err
+	}
+	return der[:n], nil
+}
+
+// encodeBase64 encodes data as base64 with lines of 64 characters.
+func encodeBase64(data []byte) []byte {
+	s := base64.StdEncoding.EncodeToString(data)
+	var buf bytes.Buffer
+	for len(s) > 64 {
+		buf.WriteString(s[:64])
+		buf.WriteByte('\n')
+		s = s[64:]
+	}
+	buf.WriteString(s)
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
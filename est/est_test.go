@@ -0,0 +1,166 @@
+package est
+
+import (
+	"context"
+	"crypto/elliptic"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mhilton/ca"
+)
+
+func TestServeEnroll(t *testing.T) {
+	ctx := context.Background()
+	key, err := ca.GenerateECDSAKey(elliptic.P256())
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuerCrt, err := ca.SelfSignCertificate(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iss, err := ca.NewIssuer(issuerCrt, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := ca.NewDirStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	iss.SetStore(store)
+	profile, err := ca.BuiltinProfile("client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv, err := New(Params{
+		Issuer:  iss,
+		Profile: profile,
+		Users:   map[string]string{"user": "password"},
+		Store:   store,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newCSR := func(name string) *x509.CertificateRequest {
+		key, err := ca.GenerateECDSAKey(elliptic.P256())
+		if err != nil {
+			t.Fatal(err)
+		}
+		csr, err := ca.SignCertificateRequest(&x509.CertificateRequest{
+			Subject:  pkix.Name{CommonName: name},
+			DNSNames: []string{name},
+		}, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return csr
+	}
+	clientCrt, err := iss.Issue(ctx, newCSR("client.example.com"), profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revokedCrt, err := iss.Issue(ctx, newCSR("revoked.example.com"), profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Revoke(ctx, revokedCrt.SerialNumber, time.Now(), 1); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		about     string
+		op        string
+		name      string
+		password  bool
+		clientCrt *x509.Certificate
+		status    int
+	}{{
+		about:    "enroll with password",
+		op:       "simpleenroll",
+		name:     "other.example.com",
+		password: true,
+		status:   http.StatusOK,
+	}, {
+		about:  "enroll without credentials",
+		op:     "simpleenroll",
+		name:   "other.example.com",
+		status: http.StatusUnauthorized,
+	}, {
+		about:     "enroll with certificate for the same names",
+		op:        "simpleenroll",
+		name:      "client.example.com",
+		clientCrt: clientCrt,
+		status:    http.StatusOK,
+	}, {
+		about:     "enroll with certificate for other names",
+		op:        "simpleenroll",
+		name:      "other.example.com",
+		clientCrt: clientCrt,
+		status:    http.StatusBadRequest,
+	}, {
+		about:     "enroll with certificate and password for other names",
+		op:        "simpleenroll",
+		name:      "other.example.com",
+		password:  true,
+		clientCrt: clientCrt,
+		status:    http.StatusOK,
+	}, {
+		about:     "reenroll",
+		op:        "simplereenroll",
+		name:      "client.example.com",
+		clientCrt: clientCrt,
+		status:    http.StatusOK,
+	}, {
+		about:     "reenroll for other names",
+		op:        "simplereenroll",
+		name:      "other.example.com",
+		clientCrt: clientCrt,
+		status:    http.StatusBadRequest,
+	}, {
+		about:     "reenroll with revoked certificate",
+		op:        "simplereenroll",
+		name:      "revoked.example.com",
+		clientCrt: revokedCrt,
+		status:    http.StatusUnauthorized,
+	}, {
+		about:     "enroll with revoked certificate",
+		op:        "simpleenroll",
+		name:      "revoked.example.com",
+		clientCrt: revokedCrt,
+		status:    http.StatusUnauthorized,
+	}}
+	for _, test := range tests {
+		t.Run(test.about, func(t *testing.T) {
+			body := encodeBase64(newCSR(test.name).Raw)
+			req := httptest.NewRequest("POST", pathPrefix+test.op, strings.NewReader(string(body)))
+			req.Header.Set("Content-Type", "application/pkcs10")
+			if test.password {
+				req.SetBasicAuth("user", "password")
+			}
+			if test.clientCrt != nil {
+				req.TLS = &tls.ConnectionState{
+					VerifiedChains: [][]*x509.Certificate{{test.clientCrt, issuerCrt}},
+				}
+			}
+			rec := httptest.NewRecorder()
+			srv.ServeHTTP(rec, req)
+			if rec.Code != test.status {
+				t.Errorf("got status %d, want %d: %s", rec.Code, test.status, rec.Body)
+			}
+		})
+	}
+}
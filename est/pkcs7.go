@@ -0,0 +1,48 @@
+package est
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+)
+
+var (
+	oidData       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+)
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"optional"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	ContentInfo      contentInfo
+	Certificates     asn1.RawValue
+	SignerInfos      asn1.RawValue
+}
+
+// marshalCertsOnly creates a degenerate PKCS#7 SignedData structure
+// containing only the given certificates (RFC 5652 section 5).
+func marshalCertsOnly(crts []*x509.Certificate) ([]byte, error) {
+	var raw []byte
+	for _, crt := range crts {
+		raw = append(raw, crt.Raw...)
+	}
+	emptySet := asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: []byte{}}
+	sd, err := asn1.Marshal(signedData{
+		Version:          1,
+		DigestAlgorithms: emptySet,
+		ContentInfo:      contentInfo{ContentType: oidData},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: raw},
+		SignerInfos:      emptySet,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sd},
+	})
+}
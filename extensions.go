@@ -0,0 +1,324 @@
+package ca
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"math/big"
+	"strconv"
+	"strings"
+
+	errgo "gopkg.in/errgo.v1"
+)
+
+// ExtensionMode determines how an ExtensionPolicy treats the
+// extensions requested in a certificate signing request.
+type ExtensionMode string
+
+const (
+	// ExtensionsIgnore ignores all requested extensions.
+	ExtensionsIgnore ExtensionMode = "ignore"
+
+	// ExtensionsCopy copies all requested extensions except those
+	// that must be determined by the CA, such as basic constraints.
+	// Those extensions are only copied if they are explicitly
+	// allowed.
+	ExtensionsCopy ExtensionMode = "copy"
+
+	// ExtensionsAllow copies requested extensions that are in the
+	// allowed list and ignores the rest.
+	ExtensionsAllow ExtensionMode = "allow"
+
+	// ExtensionsReject copies requested extensions that are in the
+	// allowed list and rejects requests containing any others.
+	ExtensionsReject ExtensionMode = "reject"
+)
+
+var (
+	oidExtensionSubjectKeyId          = asn1.ObjectIdentifier{2, 5, 29, 14}
+	oidExtensionKeyUsage              = asn1.ObjectIdentifier{2, 5, 29, 15}
+	oidExtensionSubjectAltName        = asn1.ObjectIdentifier{2, 5, 29, 17}
+	oidExtensionIssuerAltName         = asn1.ObjectIdentifier{2, 5, 29, 18}
+	oidExtensionBasicConstraints      = asn1.ObjectIdentifier{2, 5, 29, 19}
+	oidExtensionNameConstraints       = asn1.ObjectIdentifier{2, 5, 29, 30}
+	oidExtensionCertificatePolicies   = asn1.ObjectIdentifier{2, 5, 29, 32}
+	oidExtensionPolicyMappings        = asn1.ObjectIdentifier{2, 5, 29, 33}
+	oidExtensionAuthorityKeyId        = asn1.ObjectIdentifier{2, 5, 29, 35}
+	oidExtensionPolicyConstraints     = asn1.ObjectIdentifier{2, 5, 29, 36}
+	oidExtensionExtendedKeyUsage      = asn1.ObjectIdentifier{2, 5, 29, 37}
+	oidExtensionInhibitAnyPolicy      = asn1.ObjectIdentifier{2, 5, 29, 54}
+	oidExtensionAuthorityInfoAccess   = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 1}
+	oidExtensionCRLDistributionPoints = asn1.ObjectIdentifier{2, 5, 29, 31}
+)
+
+// caExtensions holds the extensions that are never copied unless
+// explicitly allowed.
+var caExtensions = []asn1.ObjectIdentifier{
+	oidExtensionSubjectKeyId,
+	oidExtensionKeyUsage,
+	oidExtensionExtendedKeyUsage,
+	oidExtensionBasicConstraints,
+	oidExtensionNameConstraints,
+	oidExtensionAuthorityKeyId,
+	oidExtensionAuthorityInfoAccess,
+	oidExtensionCRLDistributionPoints,
+	oidExtensionIssuerAltName,
+	oidExtensionCertificatePolicies,
+	oidExtensionPolicyMappings,
+	oidExtensionPolicyConstraints,
+	oidExtensionInhibitAnyPolicy,
+}
+
+// An ExtensionPolicy determines which of the extensions requested in
+// a certificate signing request are included in the issued
+// certificate. The subject alternative name extension is not subject
+// to the policy, the names it contains are always handled separately.
+type ExtensionPolicy struct {
+	// Mode determines how requested extensions are treated. The zero
+	// value is equivalent to ExtensionsIgnore.
+	Mode ExtensionMode
+
+	// Allowed holds the OIDs of extensions that may be copied.
+	Allowed []asn1.ObjectIdentifier
+}
+
+// Extensions returns the requested extensions from the given
+// certificate signing request that the policy allows to be copied to
+// the issued certificate. These are suitable for use as the
+// ExtraExtensions of the certificate template.
+func (p ExtensionPolicy) Extensions(csr *x509.CertificateRequest) ([]pkix.Extension, error) {
+	var exts []pkix.Extension
+	for _, ext := range csr.Extensions {
+		if ext.Id.Equal(oidExtensionSubjectAltName) {
+			continue
+		}
+		allowed := containsOID(p.Allowed, ext.Id)
+		switch p.Mode {
+		case "", ExtensionsIgnore:
+		case ExtensionsCopy:
+			if allowed || !containsOID(caExtensions, ext.Id) {
+				exts = append(exts, ext)
+			}
+		case ExtensionsAllow:
+			if allowed {
+				exts = append(exts, ext)
+			}
+		case ExtensionsReject:
+			if !allowed {
+				return nil, errgo.Newf("extension %s not allowed", ext.Id)
+			}
+			exts = append(exts, ext)
+		default:
+			return nil, errgo.Newf("unknown extension mode %q", p.Mode)
+		}
+	}
+	return exts, nil
+}
+
+func containsOID(oids []asn1.ObjectIdentifier, oid asn1.ObjectIdentifier) bool {
+	for _, o := range oids {
+		if o.Equal(oid) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddRequestedExtensions adds exts, the extensions copied from a
+// certificate signing request by ExtensionPolicy.Extensions, to the
+// ExtraExtensions of template. An extension is not added if the
+// template already produces an extension with the same OID, either in
+// its ExtraExtensions or from one of its fields, so that a requested
+// extension can never replace one determined by the CA.
+func AddRequestedExtensions(template *x509.Certificate, exts []pkix.Extension) {
+	produced := templateExtensions(template)
+	for _, ext := range exts {
+		if !containsOID(produced, ext.Id) && !containsExtension(template.ExtraExtensions, ext.Id) {
+			template.ExtraExtensions = append(template.ExtraExtensions, ext)
+		}
+	}
+}
+
+// templateExtensions returns the OIDs of the extensions that
+// x509.CreateCertificate generates from the fields of template.
+func templateExtensions(t *x509.Certificate) []asn1.ObjectIdentifier {
+	// The subject and authority key identifiers are always
+	// generated when signing.
+	oids := []asn1.ObjectIdentifier{oidExtensionSubjectKeyId, oidExtensionAuthorityKeyId}
+	add := func(present bool, oid asn1.ObjectIdentifier) {
+		if present {
+			oids = append(oids, oid)
+		}
+	}
+	add(t.KeyUsage != 0, oidExtensionKeyUsage)
+	add(len(t.ExtKeyUsage) > 0 || len(t.UnknownExtKeyUsage) > 0, oidExtensionExtendedKeyUsage)
+	add(t.BasicConstraintsValid, oidExtensionBasicConstraints)
+	add(len(t.OCSPServer) > 0 || len(t.IssuingCertificateURL) > 0, oidExtensionAuthorityInfoAccess)
+	add(hasSANs(t), oidExtensionSubjectAltName)
+	add(len(t.PolicyIdentifiers) > 0 || len(t.Policies) > 0, oidExtensionCertificatePolicies)
+	add(len(t.PermittedDNSDomains) > 0 || len(t.ExcludedDNSDomains) > 0 ||
+		len(t.PermittedIPRanges) > 0 || len(t.ExcludedIPRanges) > 0 ||
+		len(t.PermittedEmailAddresses) > 0 || len(t.ExcludedEmailAddresses) > 0 ||
+		len(t.PermittedURIDomains) > 0 || len(t.ExcludedURIDomains) > 0, oidExtensionNameConstraints)
+	add(len(t.CRLDistributionPoints) > 0, oidExtensionCRLDistributionPoints)
+	return oids
+}
+
+func hasSANs(t *x509.Certificate) bool {
+	return len(t.DNSNames) > 0 || len(t.EmailAddresses) > 0 || len(t.IPAddresses) > 0 || len(t.URIs) > 0
+}
+
+// MergeExtensions returns a new slice containing exts followed by
+// those of more whose OIDs are not already present.
+func MergeExtensions(exts []pkix.Extension, more ...pkix.Extension) []pkix.Extension {
+	merged := append([]pkix.Extension(nil), exts...)
+	for _, ext := range more {
+		if !containsExtension(merged, ext.Id) {
+			merged = append(merged, ext)
+		}
+	}
+	return merged
+}
+
+// checkDuplicateExtensions returns an error if there is more than one
+// extension with the same OID in exts.
+func checkDuplicateExtensions(exts []pkix.Extension) error {
+	for i, ext := range exts {
+		if containsExtension(exts[:i], ext.Id) {
+			return errgo.Newf("duplicate extension %s", ext.Id)
+		}
+	}
+	return nil
+}
+
+func containsExtension(exts []pkix.Extension, oid asn1.ObjectIdentifier) bool {
+	for _, ext := range exts {
+		if ext.Id.Equal(oid) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseExtension parses an extension specified as
+// "oid[,critical]=value", for example
+// "1.3.6.1.4.1.99999.1,critical=asn1:UTF8String:example". See
+// ParseExtensionValue for the format of the value.
+func ParseExtension(s string) (pkix.Extension, error) {
+	var ext pkix.Extension
+	i := strings.Index(s, "=")
+	if i < 0 {
+		return ext, errgo.Newf("invalid extension %q", s)
+	}
+	id, value := s[:i], s[i+1:]
+	if j := strings.Index(id, ","); j >= 0 {
+		if id[j+1:] != "critical" {
+			return ext, errgo.Newf("invalid extension %q", s)
+		}
+		ext.Critical = true
+		id = id[:j]
+	}
+	var err error
+	ext.Id, err = ParseOID(id)
+	if err != nil {
+		return ext, errgo.Mask(err)
+	}
+	ext.Value, err = ParseExtensionValue(value)
+	if err != nil {
+		return ext, errgo.Notef(err, "invalid value for extension %s", ext.Id)
+	}
+	return ext, nil
+}
+
+// ParseExtensionValue parses the DER encoded value of an extension.
+// The value is given in one of the following forms:
+//
+//	der:<base64 encoded DER>
+//	hex:<hex encoded DER, optionally separated by colons>
+//	asn1:<type>:<text>
+//
+// The asn1 form encodes a single ASN.1 value. The type is one of
+// UTF8String, PrintableString, IA5String, INTEGER, BOOLEAN, OID, NULL
+// or OCTETSTRING, for which the text is hex encoded. Type names are
+// not case sensitive.
+func ParseExtensionValue(s string) ([]byte, error) {
+	i := strings.Index(s, ":")
+	if i < 0 {
+		return nil, errgo.Newf("invalid extension value %q", s)
+	}
+	var der []byte
+	var err error
+	switch v := s[i+1:]; strings.ToLower(s[:i]) {
+	case "der":
+		der, err = base64.StdEncoding.DecodeString(v)
+	case "hex":
+		der, err = hex.DecodeString(strings.Replace(v, ":", "", -1))
+	case "asn1":
+		return parseASN1Value(v)
+	default:
+		return nil, errgo.Newf("unknown extension value format %q", s[:i])
+	}
+	if err != nil {
+		return nil, errgo.Notef(err, "invalid extension value")
+	}
+	var raw asn1.RawValue
+	if rest, err := asn1.Unmarshal(der, &raw); err != nil || len(rest) > 0 {
+		return nil, errgo.New("extension value is not a single DER encoded value")
+	}
+	return der, nil
+}
+
+func parseASN1Value(s string) ([]byte, error) {
+	typ, text := s, ""
+	if i := strings.Index(s, ":"); i >= 0 {
+		typ, text = s[:i], s[i+1:]
+	}
+	var v interface{}
+	params := ""
+	switch strings.ToLower(typ) {
+	case "utf8string":
+		v, params = text, "utf8"
+	case "printablestring":
+		v, params = text, "printable"
+	case "ia5string":
+		v, params = text, "ia5"
+	case "integer":
+		n, ok := new(big.Int).SetString(text, 0)
+		if !ok {
+			return nil, errgo.Newf("invalid INTEGER %q", text)
+		}
+		v = n
+	case "boolean":
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return nil, errgo.Newf("invalid BOOLEAN %q", text)
+		}
+		v = b
+	case "oid":
+		oid, err := ParseOID(text)
+		if err != nil {
+			return nil, errgo.Mask(err)
+		}
+		v = oid
+	case "null":
+		if text != "" {
+			return nil, errgo.New("NULL cannot have a value")
+		}
+		v = asn1.NullRawValue
+	case "octetstring":
+		b, err := hex.DecodeString(strings.Replace(text, ":", "", -1))
+		if err != nil {
+			return nil, errgo.Newf("invalid OCTETSTRING %q", text)
+		}
+		v = b
+	default:
+		return nil, errgo.Newf("unsupported ASN.1 type %q", typ)
+	}
+	der, err := asn1.MarshalWithParams(v, params)
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot encode %s", typ)
+	}
+	return der, nil
+}
@@ -0,0 +1,259 @@
+package ca
+
+import (
+	"crypto/elliptic"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"testing"
+	"time"
+)
+
+var (
+	testOIDCustom = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 1}
+	testOIDOther  = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 2}
+)
+
+func testRequest() *x509.CertificateRequest {
+	return &x509.CertificateRequest{
+		Extensions: []pkix.Extension{
+			{Id: oidExtensionSubjectAltName, Value: []byte{0x30, 0x00}},
+			{Id: oidExtensionKeyUsage, Critical: true, Value: []byte{0x03, 0x02, 0x01, 0x06}},
+			{Id: oidExtensionExtendedKeyUsage, Value: []byte{0x30, 0x00}},
+			{Id: oidExtensionBasicConstraints, Critical: true, Value: []byte{0x30, 0x03, 0x01, 0x01, 0xff}},
+			{Id: oidExtensionCertificatePolicies, Value: []byte{0x30, 0x06, 0x30, 0x04, 0x06, 0x02, 0x2a, 0x03}},
+			{Id: oidExtensionInhibitAnyPolicy, Critical: true, Value: []byte{0x02, 0x01, 0x00}},
+			{Id: testOIDCustom, Value: []byte{0x05, 0x00}},
+			{Id: testOIDOther, Value: []byte{0x05, 0x00}},
+		},
+	}
+}
+
+func extensionIDs(exts []pkix.Extension) []string {
+	ids := make([]string, len(exts))
+	for i, ext := range exts {
+		ids[i] = ext.Id.String()
+	}
+	return ids
+}
+
+func TestExtensionPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  ExtensionPolicy
+		want    []asn1.ObjectIdentifier
+		wantErr bool
+	}{{
+		name:   "ignore",
+		policy: ExtensionPolicy{},
+	}, {
+		name:   "copy",
+		policy: ExtensionPolicy{Mode: ExtensionsCopy},
+		want:   []asn1.ObjectIdentifier{testOIDCustom, testOIDOther},
+	}, {
+		name:   "copy allowed CA extension",
+		policy: ExtensionPolicy{Mode: ExtensionsCopy, Allowed: []asn1.ObjectIdentifier{oidExtensionExtendedKeyUsage}},
+		want:   []asn1.ObjectIdentifier{oidExtensionExtendedKeyUsage, testOIDCustom, testOIDOther},
+	}, {
+		name:   "allow",
+		policy: ExtensionPolicy{Mode: ExtensionsAllow, Allowed: []asn1.ObjectIdentifier{testOIDCustom}},
+		want:   []asn1.ObjectIdentifier{testOIDCustom},
+	}, {
+		name:    "reject",
+		policy:  ExtensionPolicy{Mode: ExtensionsReject, Allowed: []asn1.ObjectIdentifier{testOIDCustom}},
+		wantErr: true,
+	}}
+	for _, test := range tests {
+		exts, err := test.policy.Extensions(testRequest())
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		got := extensionIDs(exts)
+		if len(got) != len(test.want) {
+			t.Errorf("%s: got extensions %v, want %v", test.name, got, test.want)
+			continue
+		}
+		for i, oid := range test.want {
+			if got[i] != oid.String() {
+				t.Errorf("%s: got extensions %v, want %v", test.name, got, test.want)
+				break
+			}
+		}
+	}
+}
+
+func TestAddRequestedExtensions(t *testing.T) {
+	tests := []struct {
+		name     string
+		template x509.Certificate
+		exts     []pkix.Extension
+		want     []asn1.ObjectIdentifier
+	}{{
+		name: "add",
+		exts: []pkix.Extension{{Id: testOIDCustom}, {Id: oidExtensionCertificatePolicies}},
+		want: []asn1.ObjectIdentifier{testOIDCustom, oidExtensionCertificatePolicies},
+	}, {
+		name:     "extra extension",
+		template: x509.Certificate{ExtraExtensions: []pkix.Extension{{Id: testOIDCustom}}},
+		exts:     []pkix.Extension{{Id: testOIDCustom}, {Id: testOIDOther}},
+		want:     []asn1.ObjectIdentifier{testOIDCustom, testOIDOther},
+	}, {
+		name: "template fields",
+		template: x509.Certificate{
+			KeyUsage:              x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+			BasicConstraintsValid: true,
+			DNSNames:              []string{"example.com"},
+			PolicyIdentifiers:     []asn1.ObjectIdentifier{{1, 2, 3}},
+			PermittedDNSDomains:   []string{"example.com"},
+			CRLDistributionPoints: []string{"http://example.com/crl"},
+			OCSPServer:            []string{"http://example.com/ocsp"},
+		},
+		exts: []pkix.Extension{
+			{Id: oidExtensionKeyUsage},
+			{Id: oidExtensionExtendedKeyUsage},
+			{Id: oidExtensionBasicConstraints},
+			{Id: oidExtensionSubjectAltName},
+			{Id: oidExtensionCertificatePolicies},
+			{Id: oidExtensionNameConstraints},
+			{Id: oidExtensionCRLDistributionPoints},
+			{Id: oidExtensionAuthorityInfoAccess},
+			{Id: oidExtensionSubjectKeyId},
+			{Id: oidExtensionAuthorityKeyId},
+			{Id: testOIDCustom},
+		},
+		want: []asn1.ObjectIdentifier{testOIDCustom},
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			template := test.template
+			AddRequestedExtensions(&template, test.exts)
+			got := extensionIDs(template.ExtraExtensions)
+			if len(got) != len(test.want) {
+				t.Fatalf("got extensions %v, want %v", got, test.want)
+			}
+			for i, oid := range test.want {
+				if got[i] != oid.String() {
+					t.Fatalf("got extensions %v, want %v", got, test.want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseExtension(t *testing.T) {
+	ext, err := ParseExtension("1.3.6.1.4.1.99999.1,critical=asn1:UTF8String:example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ext.Id.Equal(testOIDCustom) || !ext.Critical || hex.EncodeToString(ext.Value) != "0c076578616d706c65" {
+		t.Errorf("unexpected extension %+v", ext)
+	}
+	ext, err = ParseExtension("1.3.6.1.4.1.99999.2=asn1:NULL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ext.Id.Equal(testOIDOther) || ext.Critical {
+		t.Errorf("unexpected extension %+v", ext)
+	}
+	for _, s := range []string{
+		"1.3.6.1.4.1.99999.1",
+		"1.3.6.1.4.1.99999.1,noncritical=asn1:NULL",
+		"not.an.oid=asn1:NULL",
+		"1.3.6.1.4.1.99999.1=asn1:NULL:x",
+	} {
+		if _, err := ParseExtension(s); err == nil {
+			t.Errorf("ParseExtension(%q): expected error", s)
+		}
+	}
+}
+
+func TestParseExtensionValue(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{"der:BQA=", "0500"},
+		{"hex:05:00", "0500"},
+		{"hex:0c0161", "0c0161"},
+		{"asn1:UTF8String:a", "0c0161"},
+		{"asn1:printablestring:a", "130161"},
+		{"asn1:IA5String:a", "160161"},
+		{"asn1:INTEGER:0x100", "02020100"},
+		{"asn1:INTEGER:-1", "0201ff"},
+		{"asn1:BOOLEAN:true", "0101ff"},
+		{"asn1:OID:1.2.3", "06022a03"},
+		{"asn1:NULL", "0500"},
+		{"asn1:OCTETSTRING:01:02", "04020102"},
+	}
+	for _, test := range tests {
+		der, err := ParseExtensionValue(test.s)
+		if err != nil {
+			t.Errorf("ParseExtensionValue(%q): %v", test.s, err)
+			continue
+		}
+		if got := hex.EncodeToString(der); got != test.want {
+			t.Errorf("ParseExtensionValue(%q): got %s, want %s", test.s, got, test.want)
+		}
+	}
+	for _, s := range []string{
+		"0500",
+		"base64:BQA=",
+		"der:!!",
+		"hex:0500ff",
+		"hex:05",
+		"asn1:REAL:1.0",
+		"asn1:INTEGER:x",
+		"asn1:BOOLEAN:maybe",
+		"asn1:PrintableString:a@b",
+		"asn1:NULL:x",
+		"asn1:OCTETSTRING:zz",
+	} {
+		if _, err := ParseExtensionValue(s); err == nil {
+			t.Errorf("ParseExtensionValue(%q): expected error", s)
+		}
+	}
+}
+
+func TestCreateCertificateExtensionErrors(t *testing.T) {
+	key, err := GenerateECDSAKey(elliptic.P256())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		exts []pkix.Extension
+	}{{
+		name: "duplicate extension",
+		exts: []pkix.Extension{
+			{Id: testOIDCustom, Value: []byte{0x05, 0x00}},
+			{Id: testOIDCustom, Value: []byte{0x05, 0x00}},
+		},
+	}, {
+		name: "invalid standard extension",
+		exts: []pkix.Extension{
+			{Id: oidExtensionBasicConstraints, Value: []byte{0x05, 0x00}},
+		},
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := SelfSignCertificate(&x509.Certificate{
+				Subject:         pkix.Name{CommonName: "test"},
+				NotBefore:       time.Now(),
+				NotAfter:        time.Now().Add(time.Hour),
+				ExtraExtensions: test.exts,
+			}, key)
+			if err == nil {
+				t.Errorf("expected error")
+			}
+		})
+	}
+}
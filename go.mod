@@ -0,0 +1,14 @@
+module github.com/mhilton/ca
+
+go 1.25.0
+
+require (
+	golang.org/x/crypto v0.54.0
+	gopkg.in/errgo.v1 v1.0.1
+	software.sslmate.com/src/go-pkcs12 v0.5.0
+)
+
+require (
+	golang.org/x/sys v0.47.0 // indirect
+	golang.org/x/term v0.45.0 // indirect
+)
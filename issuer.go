@@ -0,0 +1,126 @@
+package ca
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"sync"
+	"time"
+
+	errgo "gopkg.in/errgo.v1"
+)
+
+// An Issuer issues certificates signed by a CA certificate and its
+// key. An Issuer is safe for concurrent use.
+type Issuer struct {
+	crt   *x509.Certificate
+	chain []*x509.Certificate
+	store Store
+	lint  func(*x509.Certificate) error
+
+	// mu serializes access to key, which need not be safe for
+	// concurrent use (for example if it is held in a hardware
+	// token). It is held only while signing; the store is
+	// responsible for the uniqueness of serial numbers.
+	mu  sync.Mutex
+	key crypto.Signer
+}
+
+// NewIssuer creates a new Issuer that signs certificates with the
+// given certificate and key. The optional chain contains the
+// certificates that link crt to a root.
+func NewIssuer(crt *x509.Certificate, key crypto.Signer, chain ...*x509.Certificate) (*Issuer, error) {
+	pub, ok := key.Public().(interface {
+		Equal(crypto.PublicKey) bool
+	})
+	if !ok || !pub.Equal(crt.PublicKey) {
+		return nil, errgo.New("key does not match certificate")
+	}
+	if !crt.BasicConstraintsValid || !crt.IsCA {
+		return nil, errgo.New("certificate is not a CA certificate")
+	}
+	return &Issuer{
+		crt:   crt,
+		chain: append([]*x509.Certificate(nil), chain...),
+		key:   key,
+	}, nil
+}
+
+// SetStore sets the store in which the issuer records the
+// certificates it issues. It must be called before the issuer is used.
+func (i *Issuer) SetStore(s Store) {
+	i.store = s
+}
+
+// SetLinter sets a function that checks each certificate before it is
+// signed. The function is called with the completed template, with its
+// PublicKey set. If it returns an error the certificate is not issued.
+// It must be called before the issuer is used.
+func (i *Issuer) SetLinter(f func(template *x509.Certificate) error) {
+	i.lint = f
+}
+
+// Certificate returns the issuer's certificate.
+func (i *Issuer) Certificate() *x509.Certificate {
+	return i.crt
+}
+
+// Chain returns the issuer's certificate followed by its chain, which
+// is suitable for appending to an issued certificate.
+func (i *Issuer) Chain() []*x509.Certificate {
+	return append([]*x509.Certificate{i.crt}, i.chain...)
+}
+
+// Issue issues a certificate for the given certificate signing request
+// according to the given profile, which must not be nil.
+func (i *Issuer) Issue(ctx context.Context, csr *x509.CertificateRequest, profile *Profile) (*x509.Certificate, error) {
+	if profile == nil {
+		return nil, errgo.New("no profile specified")
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, errgo.Notef(err, "invalid certificate signing request")
+	}
+	if err := profile.CheckRequest(csr); err != nil {
+		return nil, errgo.Mask(err)
+	}
+	template := profile.Template(time.Now())
+	template.Subject = csr.Subject
+	// Use the encoded subject so that attributes that pkix.Name does
+	// not hold, and the string types used, are preserved.
+	template.RawSubject = csr.RawSubject
+	template.DNSNames = csr.DNSNames
+	template.EmailAddresses = csr.EmailAddresses
+	template.IPAddresses = csr.IPAddresses
+	template.URIs = csr.URIs
+	exts, err := profile.Extensions.Extensions(csr)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	AddRequestedExtensions(template, exts)
+	return i.IssueFor(ctx, csr.PublicKey, template)
+}
+
+// IssueFor issues a certificate for the given public key using the
+// given template. The template is not modified.
+func (i *Issuer) IssueFor(ctx context.Context, publicKey crypto.PublicKey, template *x509.Certificate) (*x509.Certificate, error) {
+	t := *template
+	if err := ctx.Err(); err != nil {
+		return nil, errgo.Mask(err, errgo.Any)
+	}
+	if err := reserveSerialNumber(ctx, i.store, &t); err != nil {
+		return nil, errgo.Mask(err, errgo.Is(ErrDuplicate))
+	}
+	if i.lint != nil {
+		t.PublicKey = publicKey
+		if err := i.lint(&t); err != nil {
+			return nil, errgo.Mask(err)
+		}
+	}
+	i.mu.Lock()
+	crt, err := createCertificate(&t, i.crt, publicKey, i.key)
+	i.mu.Unlock()
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot issue certificate")
+	}
+	return recordCertificate(ctx, i.store, crt)
+}
@@ -0,0 +1,114 @@
+package ca
+
+import (
+	"bytes"
+	"context"
+	"crypto/elliptic"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"testing"
+)
+
+func TestIssuePreservesRawSubject(t *testing.T) {
+	iss := newTestIssuer(t)
+	key, err := GenerateECDSAKey(elliptic.P256())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ia5, err := asn1.MarshalWithParams("example", "ia5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The subject has a multi-valued RDN, an IA5String value and an
+	// attribute type not held by pkix.Name.
+	rawSubject, err := asn1.Marshal(pkix.RDNSequence{
+		{{Type: asn1.ObjectIdentifier{0, 9, 2342, 19200300, 100, 1, 25}, Value: asn1.RawValue{FullBytes: ia5}}},
+		{
+			{Type: asn1.ObjectIdentifier{2, 5, 4, 3}, Value: "example.com"},
+			{Type: asn1.ObjectIdentifier{0, 9, 2342, 19200300, 100, 1, 1}, Value: "jsmith"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := SignCertificateRequest(&x509.CertificateRequest{
+		RawSubject: rawSubject,
+		DNSNames:   []string{"example.com"},
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	profile, err := BuiltinProfile("server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	crt, err := iss.Issue(context.Background(), csr, profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(crt.RawSubject, rawSubject) {
+		t.Errorf("subject not preserved: got %x, want %x", crt.RawSubject, rawSubject)
+	}
+}
+
+func TestIssueNilProfile(t *testing.T) {
+	iss := newTestIssuer(t)
+	key, err := GenerateECDSAKey(elliptic.P256())
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := SignCertificateRequest(&x509.CertificateRequest{
+		DNSNames: []string{"example.com"},
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := iss.Issue(context.Background(), csr, nil); err == nil {
+		t.Errorf("expected error issuing with no profile")
+	}
+}
+
+func TestIssueConcurrent(t *testing.T) {
+	ctx := context.Background()
+	iss := newTestIssuer(t)
+	s, err := NewDirStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	iss.SetStore(s)
+	key, err := GenerateECDSAKey(elliptic.P256())
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := SignCertificateRequest(&x509.CertificateRequest{
+		DNSNames: []string{"example.com"},
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	profile, err := BuiltinProfile("server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const n = 10
+	errs := make(chan error, n)
+	for j := 0; j < n; j++ {
+		go func() {
+			_, err := iss.Issue(ctx, csr, profile)
+			errs <- err
+		}()
+	}
+	for j := 0; j < n; j++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+	recs, err := s.Find(ctx, Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != n {
+		t.Errorf("got %d records, want %d", len(recs), n)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
@@ -49,27 +50,52 @@ func UnmarshalKey(b *pem.Block) (crypto.Signer, error) {
 	return key.(crypto.Signer), nil
 }
 
-func MarshalKey(key crypto.Signer) (*pem.Block, error) {
+// KeyFormat specifies the encoding used when marshaling a private key.
+type KeyFormat int
+
+const (
+	// KeyFormatLegacy encodes RSA keys as PKCS#1 "RSA PRIVATE KEY"
+	// blocks and ECDSA keys as SEC 1 "EC PRIVATE KEY" blocks. Keys
+	// that have no legacy encoding are encoded as PKCS#8.
+	KeyFormatLegacy KeyFormat = iota
+
+	// KeyFormatPKCS8 encodes all keys as PKCS#8 "PRIVATE KEY" blocks.
+	KeyFormatPKCS8
+)
+
+func MarshalKey(key crypto.Signer, format KeyFormat) (*pem.Block, error) {
 	b := new(pem.Block)
+	var err error
 	switch v := key.(type) {
 	case (*rsa.PrivateKey):
-		b.Type = "RSA PRIVATE KEY"
-		b.Bytes = x509.MarshalPKCS1PrivateKey(v)
+		if format == KeyFormatLegacy {
+			b.Type = "RSA PRIVATE KEY"
+			b.Bytes = x509.MarshalPKCS1PrivateKey(v)
+			return b, nil
+		}
 	case (*ecdsa.PrivateKey):
-		b.Type = "EC PRIVATE KEY"
-		var err error
-		b.Bytes, err = x509.MarshalECPrivateKey(v)
-		if err != nil {
-			return nil, errgo.Notef(err, "cannot marshal key")
+		if format == KeyFormatLegacy {
+			b.Type = "EC PRIVATE KEY"
+			b.Bytes, err = x509.MarshalECPrivateKey(v)
+			if err != nil {
+				return nil, errgo.Notef(err, "cannot marshal key")
+			}
+			return b, nil
 		}
+	case ed25519.PrivateKey:
 	default:
 		return nil, errgo.Newf("unsupported key type %T", key)
 	}
+	b.Type = "PRIVATE KEY"
+	b.Bytes, err = x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot marshal key")
+	}
 	return b, nil
 }
 
-func WriteKey(ctx context.Context, w io.Writer, key crypto.Signer, pg PassphraseGetter, alg x509.PEMCipher) error {
-	b, err := MarshalKey(key)
+func WriteKey(ctx context.Context, w io.Writer, key crypto.Signer, format KeyFormat, pg PassphraseGetter, alg KeyCipher) error {
+	b, err := MarshalKey(key, format)
 	if err != nil {
 		return errgo.Mask(err)
 	}
@@ -85,3 +111,8 @@ func GenerateECDSAKey(curve elliptic.Curve) (crypto.Signer, error) {
 	key, err := ecdsa.GenerateKey(curve, rand.Reader)
 	return key, errgo.Mask(err)
 }
+
+func GenerateEd25519Key() (crypto.Signer, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	return key, errgo.Mask(err)
+}
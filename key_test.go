@@ -0,0 +1,56 @@
+package ca
+
+import (
+	"crypto"
+	"crypto/elliptic"
+	"testing"
+)
+
+var keyRoundTripTests = []struct {
+	name       string
+	generate   func() (crypto.Signer, error)
+	legacyType string
+}{{
+	name:       "RSA",
+	generate:   func() (crypto.Signer, error) { return GenerateRSAKey(2048) },
+	legacyType: "RSA PRIVATE KEY",
+}, {
+	name:       "ECDSA",
+	generate:   func() (crypto.Signer, error) { return GenerateECDSAKey(elliptic.P256()) },
+	legacyType: "EC PRIVATE KEY",
+}, {
+	name:       "Ed25519",
+	generate:   GenerateEd25519Key,
+	legacyType: "PRIVATE KEY",
+}}
+
+func TestMarshalKeyRoundTrip(t *testing.T) {
+	for _, test := range keyRoundTripTests {
+		key, err := test.generate()
+		if err != nil {
+			t.Fatalf("%s: cannot generate key: %v", test.name, err)
+		}
+		for _, format := range []KeyFormat{KeyFormatLegacy, KeyFormatPKCS8} {
+			b, err := MarshalKey(key, format)
+			if err != nil {
+				t.Errorf("%s/%d: MarshalKey: %v", test.name, format, err)
+				continue
+			}
+			wantType := test.legacyType
+			if format == KeyFormatPKCS8 {
+				wantType = "PRIVATE KEY"
+			}
+			if b.Type != wantType {
+				t.Errorf("%s/%d: got block type %q, want %q", test.name, format, b.Type, wantType)
+			}
+			key2, err := UnmarshalKey(b)
+			if err != nil {
+				t.Errorf("%s/%d: UnmarshalKey: %v", test.name, format, err)
+				continue
+			}
+			if !key2.(interface{ Equal(crypto.PrivateKey) bool }).Equal(key) {
+				t.Errorf("%s/%d: key does not round trip", test.name, format)
+			}
+		}
+	}
+}
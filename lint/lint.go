@@ -0,0 +1,292 @@
+// Package lint checks certificates against a set of rules based on the
+// CA/Browser Forum baseline requirements. Checks can be run against
+// issued certificates or against certificate templates before they are
+// signed.
+package lint
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	errgo "gopkg.in/errgo.v1"
+)
+
+// Severity is the severity of a Problem.
+type Severity string
+
+const (
+	// Error problems should prevent a certificate being issued.
+	Error Severity = "error"
+
+	// Warning problems are reported but do not prevent a
+	// certificate being issued.
+	Warning Severity = "warning"
+)
+
+// A Problem is a failure of a certificate to meet a rule.
+type Problem struct {
+	// Rule holds the name of the rule that was broken.
+	Rule     string
+	Severity Severity
+	Message  string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s: %s: %s", p.Severity, p.Rule, p.Message)
+}
+
+const (
+	// DefaultMaxValidity is the maximum validity of an end-entity
+	// certificate used if none is specified.
+	DefaultMaxValidity = 398 * 24 * time.Hour
+
+	// DefaultMinRSABits is the minimum size of an RSA key used if
+	// none is specified.
+	DefaultMinRSABits = 2048
+)
+
+// Options holds the parameters of the rules.
+type Options struct {
+	// MaxValidity is the maximum validity of an end-entity
+	// certificate. If it is zero DefaultMaxValidity is used.
+	MaxValidity time.Duration
+
+	// MinRSABits is the minimum size of an RSA key. If it is zero
+	// DefaultMinRSABits is used.
+	MinRSABits int
+
+	// IssuerKey optionally holds the public key of the issuer that
+	// will sign the certificate. A template has no signature
+	// algorithm until it is signed, so when checking a template
+	// IssuerKey should be set so that the key and the signature
+	// algorithm it implies can be checked.
+	IssuerKey crypto.PublicKey
+}
+
+// A checker accumulates the problems found while checking a
+// certificate.
+type checker struct {
+	crt      *x509.Certificate
+	opts     Options
+	rule     string
+	problems []Problem
+}
+
+func (c *checker) errorf(format string, args ...interface{}) {
+	c.add(Error, format, args...)
+}
+
+func (c *checker) warnf(format string, args ...interface{}) {
+	c.add(Warning, format, args...)
+}
+
+func (c *checker) add(s Severity, format string, args ...interface{}) {
+	c.problems = append(c.problems, Problem{
+		Rule:     c.rule,
+		Severity: s,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// rules holds the rules checked by Check, in the order they are run.
+var rules = []struct {
+	name  string
+	check func(*checker)
+}{
+	{"san-required", checkSANRequired},
+	{"cn-in-san", checkCNInSAN},
+	{"validity", checkValidity},
+	{"key-size", checkKeySize},
+	{"signature-algorithm", checkSignatureAlgorithm},
+	{"ca-key-usage", checkCAKeyUsage},
+	{"ext-key-usage", checkExtKeyUsage},
+	{"serial-number", checkSerialNumber},
+}
+
+// Check checks crt against all the rules and returns the problems
+// found. The certificate may be a template that has not yet been
+// signed, in which case its PublicKey, and preferably opts.IssuerKey,
+// must be set; rules that depend on values generated at signing time,
+// such as the serial number, are skipped when those values are not yet
+// set.
+func Check(crt *x509.Certificate, opts *Options) []Problem {
+	c := &checker{crt: crt}
+	if opts != nil {
+		c.opts = *opts
+	}
+	if c.opts.MaxValidity == 0 {
+		c.opts.MaxValidity = DefaultMaxValidity
+	}
+	if c.opts.MinRSABits == 0 {
+		c.opts.MinRSABits = DefaultMinRSABits
+	}
+	for _, r := range rules {
+		c.rule = r.name
+		r.check(c)
+	}
+	return c.problems
+}
+
+// Err returns an error describing the problems with Error severity, or
+// nil if there are none.
+func Err(problems []Problem) error {
+	var msgs []string
+	for _, p := range problems {
+		if p.Severity == Error {
+			msgs = append(msgs, p.Rule+": "+p.Message)
+		}
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	return errgo.Newf("certificate failed lint checks: %s", strings.Join(msgs, "; "))
+}
+
+func hasSANs(crt *x509.Certificate) bool {
+	return len(crt.DNSNames) > 0 || len(crt.EmailAddresses) > 0 || len(crt.IPAddresses) > 0 || len(crt.URIs) > 0
+}
+
+func checkSANRequired(c *checker) {
+	if !c.crt.IsCA && !hasSANs(c.crt) {
+		c.errorf("end-entity certificate has no subject alternative names")
+	}
+}
+
+func checkCNInSAN(c *checker) {
+	cn := c.crt.Subject.CommonName
+	if c.crt.IsCA || cn == "" || !hasSANs(c.crt) {
+		return
+	}
+	for _, name := range c.crt.DNSNames {
+		if strings.EqualFold(name, cn) {
+			return
+		}
+	}
+	for _, email := range c.crt.EmailAddresses {
+		if email == cn {
+			return
+		}
+	}
+	if ip := net.ParseIP(cn); ip != nil {
+		for _, sanIP := range c.crt.IPAddresses {
+			if sanIP.Equal(ip) {
+				return
+			}
+		}
+	}
+	c.warnf("common name %q is not one of the subject alternative names", cn)
+}
+
+func checkValidity(c *checker) {
+	crt := c.crt
+	if !crt.NotAfter.After(crt.NotBefore) {
+		c.errorf("certificate expires before it becomes valid")
+		return
+	}
+	if d := crt.NotAfter.Sub(crt.NotBefore); !crt.IsCA && d > c.opts.MaxValidity {
+		c.errorf("validity of %s exceeds the maximum of %s", formatDuration(d), formatDuration(c.opts.MaxValidity))
+	}
+}
+
+func checkKeySize(c *checker) {
+	if c.crt.PublicKey == nil {
+		c.errorf("certificate has no public key")
+		return
+	}
+	if msg := c.checkKey(c.crt.PublicKey); msg != "" {
+		c.errorf("%s", msg)
+	}
+}
+
+// checkKey returns a description of the problem with the size of the
+// given key, or "" if there is none.
+func (c *checker) checkKey(key crypto.PublicKey) string {
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		if n := pub.N.BitLen(); n < c.opts.MinRSABits {
+			return fmt.Sprintf("RSA key size of %d bits is less than the minimum of %d", n, c.opts.MinRSABits)
+		}
+	case *ecdsa.PublicKey:
+		if n := pub.Curve.Params().BitSize; n < 256 {
+			return fmt.Sprintf("ECDSA curve %s is too small", pub.Curve.Params().Name)
+		}
+	}
+	return ""
+}
+
+func checkSignatureAlgorithm(c *checker) {
+	switch alg := c.crt.SignatureAlgorithm; alg {
+	case x509.MD2WithRSA, x509.MD5WithRSA, x509.SHA1WithRSA, x509.DSAWithSHA1, x509.ECDSAWithSHA1:
+		c.errorf("signature algorithm %s is not allowed", alg)
+	}
+	if c.opts.IssuerKey == nil {
+		return
+	}
+	switch c.opts.IssuerKey.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
+		// The algorithms that crypto/x509 chooses for these key
+		// types all use SHA-256 or better.
+	default:
+		c.errorf("issuer key of type %T is not supported", c.opts.IssuerKey)
+		return
+	}
+	if msg := c.checkKey(c.opts.IssuerKey); msg != "" {
+		c.errorf("issuer %s", msg)
+	}
+}
+
+func checkCAKeyUsage(c *checker) {
+	crt := c.crt
+	certSign := crt.KeyUsage&x509.KeyUsageCertSign != 0
+	switch {
+	case crt.IsCA && !crt.BasicConstraintsValid:
+		c.errorf("CA certificate has no basic constraints")
+	case crt.IsCA && !certSign:
+		c.errorf("CA certificate does not have the keyCertSign key usage")
+	case !crt.IsCA && certSign:
+		c.errorf("end-entity certificate has the keyCertSign key usage")
+	case !crt.IsCA && crt.KeyUsage&x509.KeyUsageCRLSign != 0:
+		c.warnf("end-entity certificate has the cRLSign key usage")
+	}
+}
+
+func checkExtKeyUsage(c *checker) {
+	crt := c.crt
+	if crt.IsCA {
+		return
+	}
+	if len(crt.ExtKeyUsage) == 0 && len(crt.UnknownExtKeyUsage) == 0 {
+		c.warnf("end-entity certificate has no extended key usage")
+	}
+	for _, eku := range crt.ExtKeyUsage {
+		if eku == x509.ExtKeyUsageAny {
+			c.warnf("end-entity certificate has the any extended key usage")
+		}
+	}
+}
+
+func checkSerialNumber(c *checker) {
+	n := c.crt.SerialNumber
+	if n == nil {
+		return
+	}
+	if n.Sign() <= 0 {
+		c.errorf("serial number is not positive")
+	} else if n.BitLen()/8+1 > 20 {
+		c.errorf("serial number is longer than 20 octets")
+	}
+}
+
+func formatDuration(d time.Duration) string {
+	if d%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%d days", d/(24*time.Hour))
+	}
+	return fmt.Sprintf("%.1f days", d.Hours()/24)
+}
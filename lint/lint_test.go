@@ -0,0 +1,188 @@
+package lint
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestCheck(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	smallECKey, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	smallRSAKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	// leaf returns a template for a valid end-entity certificate,
+	// modified by f.
+	leaf := func(f func(*x509.Certificate)) *x509.Certificate {
+		crt := &x509.Certificate{
+			Subject:     pkix.Name{CommonName: "example.com"},
+			DNSNames:    []string{"example.com"},
+			NotBefore:   now,
+			NotAfter:    now.Add(90 * 24 * time.Hour),
+			PublicKey:   &ecKey.PublicKey,
+			KeyUsage:    x509.KeyUsageDigitalSignature,
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}
+		if f != nil {
+			f(crt)
+		}
+		return crt
+	}
+	tests := []struct {
+		about     string
+		crt       *x509.Certificate
+		issuerKey crypto.PublicKey
+		want      []string
+	}{{
+		about:     "valid",
+		crt:       leaf(nil),
+		issuerKey: &ecKey.PublicKey,
+	}, {
+		about: "valid CA",
+		crt: leaf(func(crt *x509.Certificate) {
+			crt.DNSNames = nil
+			crt.ExtKeyUsage = nil
+			crt.IsCA = true
+			crt.BasicConstraintsValid = true
+			crt.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+			crt.NotAfter = now.Add(10 * 365 * 24 * time.Hour)
+		}),
+	}, {
+		about: "no SANs",
+		crt: leaf(func(crt *x509.Certificate) {
+			crt.DNSNames = nil
+		}),
+		want: []string{"error: san-required"},
+	}, {
+		about: "CN not in SANs",
+		crt: leaf(func(crt *x509.Certificate) {
+			crt.DNSNames = []string{"www.example.com"}
+		}),
+		want: []string{"warning: cn-in-san"},
+	}, {
+		about: "expires before valid",
+		crt: leaf(func(crt *x509.Certificate) {
+			crt.NotAfter = now.Add(-time.Hour)
+		}),
+		want: []string{"error: validity"},
+	}, {
+		about: "validity too long",
+		crt: leaf(func(crt *x509.Certificate) {
+			crt.NotAfter = now.Add(DefaultMaxValidity + time.Hour)
+		}),
+		want: []string{"error: validity"},
+	}, {
+		about: "small RSA key",
+		crt: leaf(func(crt *x509.Certificate) {
+			crt.PublicKey = &smallRSAKey.PublicKey
+		}),
+		want: []string{"error: key-size"},
+	}, {
+		about: "small ECDSA key",
+		crt: leaf(func(crt *x509.Certificate) {
+			crt.PublicKey = &smallECKey.PublicKey
+		}),
+		want: []string{"error: key-size"},
+	}, {
+		about: "SHA-1 signature",
+		crt: leaf(func(crt *x509.Certificate) {
+			crt.SignatureAlgorithm = x509.ECDSAWithSHA1
+		}),
+		issuerKey: &ecKey.PublicKey,
+		want:      []string{"error: signature-algorithm"},
+	}, {
+		about:     "small issuer RSA key",
+		crt:       leaf(nil),
+		issuerKey: &smallRSAKey.PublicKey,
+		want:      []string{"error: signature-algorithm"},
+	}, {
+		about:     "small issuer ECDSA key",
+		crt:       leaf(nil),
+		issuerKey: &smallECKey.PublicKey,
+		want:      []string{"error: signature-algorithm"},
+	}, {
+		about: "CA without keyCertSign",
+		crt: leaf(func(crt *x509.Certificate) {
+			crt.IsCA = true
+			crt.BasicConstraintsValid = true
+		}),
+		want: []string{"error: ca-key-usage"},
+	}, {
+		about: "end-entity with keyCertSign",
+		crt: leaf(func(crt *x509.Certificate) {
+			crt.KeyUsage |= x509.KeyUsageCertSign
+		}),
+		want: []string{"error: ca-key-usage"},
+	}, {
+		about: "no extended key usage",
+		crt: leaf(func(crt *x509.Certificate) {
+			crt.ExtKeyUsage = nil
+		}),
+		want: []string{"warning: ext-key-usage"},
+	}, {
+		about: "any extended key usage",
+		crt: leaf(func(crt *x509.Certificate) {
+			crt.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageAny}
+		}),
+		want: []string{"warning: ext-key-usage"},
+	}, {
+		about: "negative serial number",
+		crt: leaf(func(crt *x509.Certificate) {
+			crt.SerialNumber = big.NewInt(-1)
+		}),
+		want: []string{"error: serial-number"},
+	}, {
+		about: "long serial number",
+		crt: leaf(func(crt *x509.Certificate) {
+			crt.SerialNumber = new(big.Int).Lsh(big.NewInt(1), 20*8)
+		}),
+		want: []string{"error: serial-number"},
+	}}
+	for _, test := range tests {
+		t.Run(test.about, func(t *testing.T) {
+			problems := Check(test.crt, &Options{IssuerKey: test.issuerKey})
+			var got []string
+			for _, p := range problems {
+				got = append(got, string(p.Severity)+": "+p.Rule)
+			}
+			if len(got) != len(test.want) {
+				t.Fatalf("got problems %q, want %q", problems, test.want)
+			}
+			for i := range got {
+				if got[i] != test.want[i] {
+					t.Errorf("got problems %q, want %q", problems, test.want)
+				}
+			}
+		})
+	}
+}
+
+func TestErr(t *testing.T) {
+	if err := Err([]Problem{{Rule: "r", Severity: Warning, Message: "m"}}); err != nil {
+		t.Errorf("unexpected error for warning: %v", err)
+	}
+	err := Err([]Problem{
+		{Rule: "a", Severity: Error, Message: "x"},
+		{Rule: "b", Severity: Warning, Message: "y"},
+		{Rule: "c", Severity: Error, Message: "z"},
+	})
+	if err == nil || err.Error() != "certificate failed lint checks: a: x; c: z" {
+		t.Errorf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+package ca
+
+import (
+	"crypto/x509"
+	"net"
+	"strings"
+
+	errgo "gopkg.in/errgo.v1"
+)
+
+// CheckNameConstraints checks that the subject alternative names in
+// crt are allowed by the name constraints in parent. Names are matched
+// in the same way as crypto/x509 does when verifying a chain, so a
+// certificate that passes this check will not fail verification
+// because of parent's constraints.
+func CheckNameConstraints(parent, crt *x509.Certificate) error {
+	for _, name := range crt.DNSNames {
+		if err := checkConstraints("DNS name", name, parent.PermittedDNSDomains, parent.ExcludedDNSDomains, matchDomain); err != nil {
+			return errgo.Mask(err)
+		}
+	}
+	for _, email := range crt.EmailAddresses {
+		if err := checkConstraints("email address", email, parent.PermittedEmailAddresses, parent.ExcludedEmailAddresses, matchEmail); err != nil {
+			return errgo.Mask(err)
+		}
+	}
+	for _, ip := range crt.IPAddresses {
+		if err := checkIPConstraints(ip, parent.PermittedIPRanges, parent.ExcludedIPRanges); err != nil {
+			return errgo.Mask(err)
+		}
+	}
+	for _, u := range crt.URIs {
+		if len(parent.PermittedURIDomains) == 0 && len(parent.ExcludedURIDomains) == 0 {
+			break
+		}
+		host := u.Hostname()
+		if host == "" || net.ParseIP(host) != nil {
+			return errgo.Newf("URI %q cannot be checked against name constraints", u)
+		}
+		if err := checkConstraints("URI", host, parent.PermittedURIDomains, parent.ExcludedURIDomains, matchDomain); err != nil {
+			return errgo.Mask(err)
+		}
+	}
+	return nil
+}
+
+func checkConstraints(kind, name string, permitted, excluded []string, match func(name, constraint string) bool) error {
+	for _, c := range excluded {
+		if match(name, c) {
+			return errgo.Newf("%s %q is excluded by the issuer's name constraints", kind, name)
+		}
+	}
+	if len(permitted) == 0 {
+		return nil
+	}
+	for _, c := range permitted {
+		if match(name, c) {
+			return nil
+		}
+	}
+	return errgo.Newf("%s %q is not permitted by the issuer's name constraints", kind, name)
+}
+
+func checkIPConstraints(ip net.IP, permitted, excluded []*net.IPNet) error {
+	for _, r := range excluded {
+		if r.Contains(ip) {
+			return errgo.Newf("IP address %s is excluded by the issuer's name constraints", ip)
+		}
+	}
+	if len(permitted) == 0 {
+		return nil
+	}
+	for _, r := range permitted {
+		if r.Contains(ip) {
+			return nil
+		}
+	}
+	return errgo.Newf("IP address %s is not permitted by the issuer's name constraints", ip)
+}
+
+// matchDomain reports whether domain matches the given constraint. A
+// constraint starting with "." matches only subdomains, otherwise it
+// matches the domain itself and its subdomains.
+func matchDomain(domain, constraint string) bool {
+	if constraint == "" {
+		return true
+	}
+	domain = strings.ToLower(domain)
+	constraint = strings.ToLower(constraint)
+	if strings.HasPrefix(constraint, ".") {
+		return strings.HasSuffix(domain, constraint) && len(domain) > len(constraint)
+	}
+	return domain == constraint || strings.HasSuffix(domain, "."+constraint)
+}
+
+// matchEmail reports whether the given email address matches the
+// given constraint, which is either a complete mailbox or a domain.
+func matchEmail(email, constraint string) bool {
+	i := strings.LastIndex(email, "@")
+	if i < 0 {
+		return false
+	}
+	if j := strings.LastIndex(constraint, "@"); j >= 0 {
+		return email[:i] == constraint[:j] && strings.EqualFold(email[i+1:], constraint[j+1:])
+	}
+	return matchDomain(email[i+1:], constraint)
+}
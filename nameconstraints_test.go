@@ -0,0 +1,112 @@
+package ca
+
+import (
+	"crypto/x509"
+	"net"
+	"net/url"
+	"testing"
+)
+
+func TestCheckNameConstraints(t *testing.T) {
+	_, ipNet10, _ := net.ParseCIDR("10.0.0.0/8")
+	_, ipNet1010, _ := net.ParseCIDR("10.10.0.0/16")
+	parent := &x509.Certificate{
+		PermittedDNSDomains:     []string{"example.com", ".example.org"},
+		ExcludedDNSDomains:      []string{"bad.example.com"},
+		PermittedEmailAddresses: []string{"example.com", "admin@example.net"},
+		PermittedIPRanges:       []*net.IPNet{ipNet10},
+		ExcludedIPRanges:        []*net.IPNet{ipNet1010},
+		PermittedURIDomains:     []string{".example.com"},
+	}
+	tests := []struct {
+		about   string
+		crt     x509.Certificate
+		wantErr bool
+	}{{
+		about: "no names",
+	}, {
+		about: "permitted domain",
+		crt:   x509.Certificate{DNSNames: []string{"example.com", "www.Example.COM"}},
+	}, {
+		about:   "domain not permitted",
+		crt:     x509.Certificate{DNSNames: []string{"example.net"}},
+		wantErr: true,
+	}, {
+		about:   "domain with permitted suffix",
+		crt:     x509.Certificate{DNSNames: []string{"notexample.com"}},
+		wantErr: true,
+	}, {
+		about:   "subdomain-only constraint does not match domain",
+		crt:     x509.Certificate{DNSNames: []string{"example.org"}},
+		wantErr: true,
+	}, {
+		about: "subdomain-only constraint matches subdomain",
+		crt:   x509.Certificate{DNSNames: []string{"www.example.org"}},
+	}, {
+		about:   "excluded domain",
+		crt:     x509.Certificate{DNSNames: []string{"www.bad.example.com"}},
+		wantErr: true,
+	}, {
+		about: "permitted email domain",
+		crt:   x509.Certificate{EmailAddresses: []string{"user@example.com"}},
+	}, {
+		about: "permitted mailbox",
+		crt:   x509.Certificate{EmailAddresses: []string{"admin@EXAMPLE.net"}},
+	}, {
+		about:   "mailbox not permitted",
+		crt:     x509.Certificate{EmailAddresses: []string{"user@example.net"}},
+		wantErr: true,
+	}, {
+		about: "permitted IP address",
+		crt:   x509.Certificate{IPAddresses: []net.IP{net.ParseIP("10.1.2.3")}},
+	}, {
+		about:   "excluded IP address",
+		crt:     x509.Certificate{IPAddresses: []net.IP{net.ParseIP("10.10.2.3")}},
+		wantErr: true,
+	}, {
+		about:   "IP address not permitted",
+		crt:     x509.Certificate{IPAddresses: []net.IP{net.ParseIP("192.168.1.1")}},
+		wantErr: true,
+	}, {
+		about: "permitted URI",
+		crt:   x509.Certificate{URIs: []*url.URL{mustParseURL(t, "https://www.example.com/path")}},
+	}, {
+		about:   "URI not permitted",
+		crt:     x509.Certificate{URIs: []*url.URL{mustParseURL(t, "https://example.com/")}},
+		wantErr: true,
+	}, {
+		about:   "URI with IP address host",
+		crt:     x509.Certificate{URIs: []*url.URL{mustParseURL(t, "https://10.0.0.1/")}},
+		wantErr: true,
+	}}
+	for _, test := range tests {
+		t.Run(test.about, func(t *testing.T) {
+			err := CheckNameConstraints(parent, &test.crt)
+			if test.wantErr && err == nil {
+				t.Errorf("expected error")
+			}
+			if !test.wantErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestCheckNameConstraintsUnconstrained(t *testing.T) {
+	crt := &x509.Certificate{
+		DNSNames:    []string{"example.com"},
+		IPAddresses: []net.IP{net.ParseIP("192.168.1.1")},
+		URIs:        []*url.URL{mustParseURL(t, "spiffe://10.0.0.1/x")},
+	}
+	if err := CheckNameConstraints(&x509.Certificate{}, crt); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func mustParseURL(t *testing.T, s string) *url.URL {
+	u, err := url.Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
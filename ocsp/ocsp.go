@@ -0,0 +1,324 @@
+// Package ocsp implements an RFC 6960 OCSP responder for certificates
+// recorded in a ca.Store.
+package ocsp
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	xocsp "golang.org/x/crypto/ocsp"
+	errgo "gopkg.in/errgo.v1"
+
+	"github.com/mhilton/ca"
+)
+
+// maxRequestSize is the maximum size of an OCSP request that will be
+// read.
+const maxRequestSize = 10000
+
+// Params holds the parameters for a Responder.
+type Params struct {
+	// Issuer holds the CA certificate for which the responder
+	// provides status information.
+	Issuer *x509.Certificate
+
+	// Responder optionally holds a delegated OCSP signing
+	// certificate issued by Issuer. If it is nil then responses are
+	// signed by Issuer directly.
+	Responder *x509.Certificate
+
+	// Key holds the key used to sign responses. It must match
+	// Responder, if that is set, or Issuer otherwise.
+	Key crypto.Signer
+
+	// Store holds the record of certificates issued by Issuer.
+	Store ca.Store
+
+	// Validity holds the length of time for which responses are
+	// valid. If this is zero a day is used.
+	Validity time.Duration
+
+	// CacheDuration holds the length of time a response is cached
+	// before a new one is created. If this is zero a quarter of
+	// Validity is used. Responses are never cached, here or by
+	// clients, beyond their NextUpdate time.
+	CacheDuration time.Duration
+}
+
+// A Responder creates OCSP responses. Responses are cached so that
+// they need not be signed for every request. A Responder is also an
+// http.Handler that serves OCSP requests using the GET and POST
+// methods described in RFC 6960 appendix A.
+type Responder struct {
+	p          Params
+	keyHashes  map[crypto.Hash][]byte
+	nameHashes map[crypto.Hash][]byte
+
+	// signMu serializes access to p.Key.
+	signMu sync.Mutex
+
+	mu    sync.Mutex
+	cache map[cacheKey]*cachedResponse
+}
+
+type cacheKey struct {
+	hash   crypto.Hash
+	serial string
+}
+
+type cachedResponse struct {
+	// expires holds the time after which the response is no longer
+	// served from the cache, which is never after its NextUpdate.
+	expires time.Time
+	der     []byte
+}
+
+var hashes = []crypto.Hash{crypto.SHA1, crypto.SHA256, crypto.SHA384, crypto.SHA512}
+
+// New creates a new Responder.
+func New(p Params) (*Responder, error) {
+	if p.Issuer == nil || p.Key == nil || p.Store == nil {
+		return nil, errgo.New("issuer, key and store must be specified")
+	}
+	signer := p.Issuer
+	if p.Responder != nil {
+		if err := p.Responder.CheckSignatureFrom(p.Issuer); err != nil {
+			return nil, errgo.Notef(err, "responder certificate not issued by issuer")
+		}
+		if !hasExtKeyUsage(p.Responder, x509.ExtKeyUsageOCSPSigning) {
+			return nil, errgo.New("responder certificate cannot be used for OCSP signing")
+		}
+		signer = p.Responder
+	}
+	pub, ok := p.Key.Public().(interface {
+		Equal(crypto.PublicKey) bool
+	})
+	if !ok || !pub.Equal(signer.PublicKey) {
+		return nil, errgo.New("key does not match certificate")
+	}
+	if p.Validity == 0 {
+		p.Validity = 24 * time.Hour
+	}
+	if p.CacheDuration == 0 {
+		p.CacheDuration = p.Validity / 4
+	}
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(p.Issuer.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return nil, errgo.Notef(err, "invalid issuer public key")
+	}
+	r := &Responder{
+		p:          p,
+		keyHashes:  make(map[crypto.Hash][]byte),
+		nameHashes: make(map[crypto.Hash][]byte),
+		cache:      make(map[cacheKey]*cachedResponse),
+	}
+	for _, h := range hashes {
+		hh := h.New()
+		hh.Write(spki.PublicKey.RightAlign())
+		r.keyHashes[h] = hh.Sum(nil)
+		hh = h.New()
+		hh.Write(p.Issuer.RawSubject)
+		r.nameHashes[h] = hh.Sum(nil)
+	}
+	return r, nil
+}
+
+func hasExtKeyUsage(crt *x509.Certificate, usage x509.ExtKeyUsage) bool {
+	for _, u := range crt.ExtKeyUsage {
+		if u == usage {
+			return true
+		}
+	}
+	return false
+}
+
+// Precompute creates and caches responses for every certificate
+// issued by the issuer that has not expired. It is intended to be
+// called periodically so that requests can be answered without
+// signing.
+func (r *Responder) Precompute(ctx context.Context) error {
+	records, err := r.p.Store.Find(ctx, ca.Query{
+		ExpiresAfter: time.Now(),
+	})
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	for _, rec := range records {
+		if !bytes.Equal(rec.Certificate.RawIssuer, r.p.Issuer.RawSubject) {
+			continue
+		}
+		if _, err := r.response(ctx, crypto.SHA1, rec); err != nil {
+			return errgo.Mask(err)
+		}
+	}
+	return nil
+}
+
+// Respond returns the DER encoded response to the given request.
+func (r *Responder) Respond(ctx context.Context, req *xocsp.Request) ([]byte, error) {
+	der, _, err := r.respond(ctx, req)
+	return der, err
+}
+
+// respond is like Respond but also returns the length of time for
+// which the response may be cached by clients, which is zero if it
+// may not be. Only responses for known certificates may be cached.
+func (r *Responder) respond(ctx context.Context, req *xocsp.Request) ([]byte, time.Duration, error) {
+	if !bytes.Equal(r.keyHashes[req.HashAlgorithm], req.IssuerKeyHash) || !bytes.Equal(r.nameHashes[req.HashAlgorithm], req.IssuerNameHash) {
+		return xocsp.UnauthorizedErrorResponse, 0, nil
+	}
+	if c := r.cached(req.HashAlgorithm, req.SerialNumber.String()); c != nil {
+		return c.der, time.Until(c.expires), nil
+	}
+	rec, err := r.p.Store.Get(ctx, req.SerialNumber)
+	if errgo.Cause(err) == ca.ErrNotFound {
+		rec = nil
+	} else if err != nil {
+		return nil, 0, errgo.Mask(err)
+	} else if !bytes.Equal(rec.Certificate.RawIssuer, r.p.Issuer.RawSubject) {
+		rec = nil
+	}
+	if rec == nil {
+		// Responses for unknown certificates are not cached, here or
+		// by clients, so that newly issued certificates are seen
+		// immediately.
+		der, _, err := r.sign(xocsp.Response{
+			Status:       xocsp.Unknown,
+			SerialNumber: req.SerialNumber,
+			IssuerHash:   req.HashAlgorithm,
+		})
+		return der, 0, errgo.Mask(err)
+	}
+	c, err := r.response(ctx, req.HashAlgorithm, rec)
+	if err != nil {
+		return nil, 0, errgo.Mask(err)
+	}
+	return c.der, time.Until(c.expires), nil
+}
+
+func (r *Responder) cached(h crypto.Hash, serial string) *cachedResponse {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c := r.cache[cacheKey{h, serial}]
+	if c == nil || !time.Now().Before(c.expires) {
+		return nil
+	}
+	return c
+}
+
+func (r *Responder) response(ctx context.Context, h crypto.Hash, rec *ca.Record) (*cachedResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, errgo.Mask(err, errgo.Any)
+	}
+	template := xocsp.Response{
+		Status:       xocsp.Good,
+		SerialNumber: rec.Certificate.SerialNumber,
+		IssuerHash:   h,
+	}
+	if rec.Revoked {
+		template.Status = xocsp.Revoked
+		template.RevokedAt = rec.RevocationTime
+		template.RevocationReason = rec.RevocationReason
+	}
+	now := time.Now()
+	der, nextUpdate, err := r.sign(template)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	c := &cachedResponse{
+		expires: now.Add(r.p.CacheDuration),
+		der:     der,
+	}
+	if nextUpdate.Before(c.expires) {
+		c.expires = nextUpdate
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cache[cacheKey{h, rec.Certificate.SerialNumber.String()}] = c
+	return c, nil
+}
+
+// sign signs a response based on the given template, returning it
+// along with its NextUpdate time.
+func (r *Responder) sign(template xocsp.Response) ([]byte, time.Time, error) {
+	now := time.Now()
+	template.ThisUpdate = now.Truncate(time.Minute)
+	template.NextUpdate = template.ThisUpdate.Add(r.p.Validity)
+	responder := r.p.Issuer
+	if r.p.Responder != nil {
+		responder = r.p.Responder
+		template.Certificate = r.p.Responder
+	}
+	r.signMu.Lock()
+	defer r.signMu.Unlock()
+	der, err := xocsp.CreateResponse(r.p.Issuer, responder, template, r.p.Key)
+	if err != nil {
+		return nil, time.Time{}, errgo.Notef(err, "cannot create OCSP response")
+	}
+	return der, template.NextUpdate, nil
+}
+
+// ServeHTTP implements http.Handler.
+func (r *Responder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var data []byte
+	switch req.Method {
+	case "GET":
+		s, err := url.PathUnescape(strings.TrimPrefix(req.URL.EscapedPath(), "/"))
+		if err == nil {
+			data, err = base64.StdEncoding.DecodeString(s)
+		}
+		if err != nil {
+			writeResponse(w, xocsp.MalformedRequestErrorResponse, 0)
+			return
+		}
+	case "POST":
+		if ct := req.Header.Get("Content-Type"); ct != "application/ocsp-request" {
+			http.Error(w, fmt.Sprintf("unsupported content type %q", ct), http.StatusUnsupportedMediaType)
+			return
+		}
+		var err error
+		data, err = ioutil.ReadAll(http.MaxBytesReader(w, req.Body, maxRequestSize))
+		if err != nil {
+			writeResponse(w, xocsp.MalformedRequestErrorResponse, 0)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ocspReq, err := xocsp.ParseRequest(data)
+	if err != nil {
+		writeResponse(w, xocsp.MalformedRequestErrorResponse, 0)
+		return
+	}
+	resp, maxAge, err := r.respond(req.Context(), ocspReq)
+	if err != nil {
+		writeResponse(w, xocsp.InternalErrorErrorResponse, 0)
+		return
+	}
+	writeResponse(w, resp, maxAge)
+}
+
+func writeResponse(w http.ResponseWriter, resp []byte, maxAge time.Duration) {
+	w.Header().Set("Content-Type", "application/ocsp-response")
+	if maxAge >= time.Second {
+		w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d, public, no-transform, must-revalidate", int(maxAge.Seconds())))
+	}
+	w.Write(resp)
+}
@@ -0,0 +1,202 @@
+package ocsp
+
+import (
+	"bytes"
+	"context"
+	"crypto/elliptic"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	xocsp "golang.org/x/crypto/ocsp"
+
+	"github.com/mhilton/ca"
+)
+
+type testCA struct {
+	issuer *x509.Certificate
+	leaf   *x509.Certificate
+	r      *Responder
+}
+
+func newTestCA(t *testing.T) *testCA {
+	ctx := context.Background()
+	s, err := ca.NewDirStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ca.GenerateECDSAKey(elliptic.P256())
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, err := ca.SelfSignCertificate(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafKey, err := ca.GenerateECDSAKey(elliptic.P256())
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := ca.SignCertificateRequest(&x509.CertificateRequest{
+		DNSNames: []string{"example.com"},
+	}, leafKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := ca.SignCertificateWithStore(ctx, s, csr, &x509.Certificate{
+		NotBefore: time.Now(),
+		NotAfter:  time.Now().Add(time.Hour),
+	}, issuer, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := New(Params{
+		Issuer: issuer,
+		Key:    key,
+		Store:  s,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{issuer: issuer, leaf: leaf, r: r}
+}
+
+func (c *testCA) post(t *testing.T, req []byte) (*http.Response, []byte) {
+	srv := httptest.NewServer(c.r)
+	defer srv.Close()
+	resp, err := http.Post(srv.URL, "application/ocsp-request", bytes.NewReader(req))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, body
+}
+
+func TestServeHTTPCacheControl(t *testing.T) {
+	c := newTestCA(t)
+	unknown := *c.leaf
+	unknown.SerialNumber = big.NewInt(12345)
+	tests := []struct {
+		about     string
+		crt       *x509.Certificate
+		status    int
+		cacheable bool
+	}{{
+		about:     "known certificate",
+		crt:       c.leaf,
+		status:    xocsp.Good,
+		cacheable: true,
+	}, {
+		about:  "unknown certificate",
+		crt:    &unknown,
+		status: xocsp.Unknown,
+	}}
+	for _, test := range tests {
+		t.Run(test.about, func(t *testing.T) {
+			req, err := xocsp.CreateRequest(test.crt, c.issuer, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, body := c.post(t, req)
+			ocspResp, err := xocsp.ParseResponseForCert(body, test.crt, c.issuer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ocspResp.Status != test.status {
+				t.Errorf("got status %d, want %d", ocspResp.Status, test.status)
+			}
+			if cc := resp.Header.Get("Cache-Control"); (cc != "") != test.cacheable {
+				t.Errorf("unexpected Cache-Control %q", cc)
+			}
+		})
+	}
+}
+
+func TestServeHTTPMaxAge(t *testing.T) {
+	c := newTestCA(t)
+	tests := []struct {
+		about         string
+		validity      time.Duration
+		cacheDuration time.Duration
+		min, max      time.Duration
+	}{{
+		about:         "cache duration",
+		validity:      time.Hour,
+		cacheDuration: 10 * time.Minute,
+		min:           9 * time.Minute,
+		max:           10 * time.Minute,
+	}, {
+		about:         "capped at next update",
+		validity:      time.Hour,
+		cacheDuration: 2 * time.Hour,
+		// ThisUpdate is truncated to the minute.
+		min: 58 * time.Minute,
+		max: time.Hour,
+	}}
+	for _, test := range tests {
+		t.Run(test.about, func(t *testing.T) {
+			p := c.r.p
+			p.Validity = test.validity
+			p.CacheDuration = test.cacheDuration
+			r, err := New(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c := &testCA{issuer: c.issuer, leaf: c.leaf, r: r}
+			req, err := xocsp.CreateRequest(c.leaf, c.issuer, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The second response is served from the cache.
+			for i := 0; i < 2; i++ {
+				resp, _ := c.post(t, req)
+				var maxAge int
+				cc := resp.Header.Get("Cache-Control")
+				if _, err := fmt.Sscanf(cc, "max-age=%d,", &maxAge); err != nil {
+					t.Fatalf("unexpected Cache-Control %q", cc)
+				}
+				if d := time.Duration(maxAge) * time.Second; d < test.min || d > test.max {
+					t.Errorf("got max-age %v, want between %v and %v", d, test.min, test.max)
+				}
+			}
+		})
+	}
+}
+
+func TestRespondChecksIssuerNameHash(t *testing.T) {
+	c := newTestCA(t)
+	der, err := xocsp.CreateRequest(c.leaf, c.issuer, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := xocsp.ParseRequest(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.IssuerNameHash = append([]byte(nil), req.IssuerNameHash...)
+	req.IssuerNameHash[0] ^= 0xff
+	resp, err := c.r.Respond(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(resp, xocsp.UnauthorizedErrorResponse) {
+		t.Errorf("got response %x, want unauthorized", resp)
+	}
+}
@@ -16,6 +16,22 @@ type PassphraseGetter interface {
 	GetPassphrase(ctx context.Context) ([]byte, error)
 }
 
+// KeyCipher is implemented by the ciphers that can be used to encrypt
+// PEM blocks with a passphrase.
+type KeyCipher interface {
+	encryptPEMBlock(b *pem.Block, passphrase []byte) (*pem.Block, error)
+}
+
+// LegacyCipher encrypts PEM blocks using the RFC 1423 scheme. It is
+// insecure and should only be used for compatibility with old
+// software.
+type LegacyCipher x509.PEMCipher
+
+func (c LegacyCipher) encryptPEMBlock(b *pem.Block, passphrase []byte) (*pem.Block, error) {
+	b, err := x509.EncryptPEMBlock(rand.Reader, b.Type, b.Bytes, passphrase, x509.PEMCipher(c))
+	return b, errgo.Mask(err)
+}
+
 func ReadPEM(r io.Reader) (*pem.Block, error) {
 	buf, err := ioutil.ReadAll(r)
 	if err != nil {
@@ -23,24 +39,69 @@ func ReadPEM(r io.Reader) (*pem.Block, error) {
 	}
 	block, _ := pem.Decode(buf)
 	if block == nil {
-		return nil, errgo.New("invalid PEM data")
+		return DERBlock(buf)
 	}
 	return block, nil
 }
 
+func ReadPEMBlocks(r io.Reader) ([]*pem.Block, error) {
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	var blocks []*pem.Block
+	for {
+		var block *pem.Block
+		block, buf = pem.Decode(buf)
+		if block == nil {
+			break
+		}
+		blocks = append(blocks, block)
+	}
+	if len(blocks) == 0 {
+		return derBlocks(buf)
+	}
+	return blocks, nil
+}
+
 func ReadEncryptedPEM(ctx context.Context, r io.Reader, pg PassphraseGetter) (*pem.Block, error) {
 	b, err := ReadPEM(r)
 	if err != nil {
 		return nil, errgo.Mask(err)
 	}
-	if !x509.IsEncryptedPEMBlock(b) {
+	b, err = DecryptPEMBlock(ctx, b, pg)
+	if err != nil {
+		return nil, errgo.Mask(err, errgo.Any)
+	}
+	return b, nil
+}
+
+// IsEncryptedPEMBlock reports whether b is encrypted, either as an
+// encrypted PKCS#8 key or using the legacy RFC 1423 scheme.
+func IsEncryptedPEMBlock(b *pem.Block) bool {
+	return b.Type == "ENCRYPTED PRIVATE KEY" || x509.IsEncryptedPEMBlock(b)
+}
+
+// DecryptPEMBlock decrypts b with a passphrase obtained from pg. If b
+// is not encrypted it is returned unchanged.
+func DecryptPEMBlock(ctx context.Context, b *pem.Block, pg PassphraseGetter) (*pem.Block, error) {
+	if !IsEncryptedPEMBlock(b) {
 		return b, nil
 	}
 	passphrase, err := pg.GetPassphrase(ctx)
 	if err != nil {
 		return nil, errgo.Mask(err, errgo.Any)
 	}
-	b.Bytes, err = x509.DecryptPEMBlock(b, passphrase)
+	if b.Type == "ENCRYPTED PRIVATE KEY" {
+		b, err = decryptPKCS8PEMBlock(b, passphrase)
+	} else {
+		var data []byte
+		data, err = x509.DecryptPEMBlock(b, passphrase)
+		b = &pem.Block{
+			Type:  b.Type,
+			Bytes: data,
+		}
+	}
 	if err != nil {
 		return nil, errgo.Notef(err, "cannot decode block")
 	}
@@ -77,21 +138,40 @@ func WritePEM(w io.Writer, b *pem.Block) error {
 	return errgo.Mask(pem.Encode(w, b))
 }
 
-func WriteEncryptedPEM(ctx context.Context, w io.Writer, b *pem.Block, pg PassphraseGetter, alg x509.PEMCipher) error {
-	var passphrase []byte
-	if alg != 0 && pg != nil {
-		var err error
-		passphrase, err = pg.GetPassphrase(ctx)
-		if err != nil {
-			return errgo.Mask(err, errgo.Any)
+func WritePEMBlocks(w io.Writer, bs []*pem.Block) error {
+	for _, b := range bs {
+		if err := WritePEM(w, b); err != nil {
+			return errgo.Mask(err)
 		}
 	}
-	if len(passphrase) > 0 {
-		var err error
-		b, err = x509.EncryptPEMBlock(rand.Reader, b.Type, b.Bytes, passphrase, alg)
-		if err != nil {
-			return errgo.Notef(err, "cannot encrypt block")
-		}
+	return nil
+}
+
+func WriteEncryptedPEM(ctx context.Context, w io.Writer, b *pem.Block, pg PassphraseGetter, alg KeyCipher) error {
+	b, err := EncryptPEMBlock(ctx, b, pg, alg)
+	if err != nil {
+		return errgo.Mask(err, errgo.Any)
 	}
 	return errgo.Mask(WritePEM(w, b))
 }
+
+// EncryptPEMBlock encrypts b using alg with a passphrase obtained from
+// pg. If alg or pg is nil, or the passphrase is empty, b is returned
+// unchanged.
+func EncryptPEMBlock(ctx context.Context, b *pem.Block, pg PassphraseGetter, alg KeyCipher) (*pem.Block, error) {
+	if alg == nil || pg == nil {
+		return b, nil
+	}
+	passphrase, err := pg.GetPassphrase(ctx)
+	if err != nil {
+		return nil, errgo.Mask(err, errgo.Any)
+	}
+	if len(passphrase) == 0 {
+		return b, nil
+	}
+	b, err = alg.encryptPEMBlock(b, passphrase)
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot encrypt block")
+	}
+	return b, nil
+}
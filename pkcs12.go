@@ -0,0 +1,66 @@
+package ca
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"io"
+	"io/ioutil"
+	"os"
+
+	errgo "gopkg.in/errgo.v1"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+func ReadPKCS12File(ctx context.Context, path string, pg PassphraseGetter) (crypto.Signer, *x509.Certificate, []*x509.Certificate, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, nil, errgo.Notef(err, "cannot open %s", path)
+	}
+	defer f.Close()
+	key, crt, chain, err := ReadPKCS12(ctx, f, pg)
+	if err != nil {
+		return nil, nil, nil, errgo.Notef(err, "cannot read PKCS#12 data from %s", path)
+	}
+	return key, crt, chain, nil
+}
+
+// ReadPKCS12 reads a PKCS#12 file containing a private key, its
+// certificate and optionally the certificate's chain. The file is
+// decrypted with a passphrase obtained from pg.
+func ReadPKCS12(ctx context.Context, r io.Reader, pg PassphraseGetter) (crypto.Signer, *x509.Certificate, []*x509.Certificate, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, nil, nil, errgo.Mask(err)
+	}
+	passphrase, err := pg.GetPassphrase(ctx)
+	if err != nil {
+		return nil, nil, nil, errgo.Mask(err, errgo.Any)
+	}
+	pk, crt, chain, err := pkcs12.DecodeChain(data, string(passphrase))
+	if err != nil {
+		return nil, nil, nil, errgo.Notef(err, "cannot decode PKCS#12 data")
+	}
+	key, ok := pk.(crypto.Signer)
+	if !ok {
+		return nil, nil, nil, errgo.Newf("unsupported key type %T", pk)
+	}
+	return key, crt, chain, nil
+}
+
+// WritePKCS12 writes key, its certificate and the certificate's chain
+// as a PKCS#12 file encrypted with a passphrase obtained from pg. The
+// file is encrypted with AES-256 and PBKDF2, as used by current
+// versions of OpenSSL, Windows and Java.
+func WritePKCS12(ctx context.Context, w io.Writer, key crypto.Signer, crt *x509.Certificate, chain []*x509.Certificate, pg PassphraseGetter) error {
+	passphrase, err := pg.GetPassphrase(ctx)
+	if err != nil {
+		return errgo.Mask(err, errgo.Any)
+	}
+	data, err := pkcs12.Modern.Encode(key, crt, chain, string(passphrase))
+	if err != nil {
+		return errgo.Notef(err, "cannot encode PKCS#12 data")
+	}
+	_, err = w.Write(data)
+	return errgo.Mask(err)
+}
@@ -0,0 +1,407 @@
+package ca
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"hash"
+
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+	errgo "gopkg.in/errgo.v1"
+)
+
+// PBES2Encryption identifies the content encryption algorithm used by
+// a PBES2Cipher. Note that OpenSSL cannot read keys encrypted with the
+// GCM modes.
+type PBES2Encryption int
+
+const (
+	AES128CBC PBES2Encryption = iota
+	AES192CBC
+	AES256CBC
+	AES128GCM
+	AES192GCM
+	AES256GCM
+)
+
+// PBES2KDF identifies the key derivation function used by a
+// PBES2Cipher.
+type PBES2KDF int
+
+const (
+	PBKDF2 PBES2KDF = iota
+	Scrypt
+)
+
+// PBES2Cipher encrypts private keys as PKCS#8 "ENCRYPTED PRIVATE KEY"
+// blocks using the PBES2 scheme from RFC 8018.
+type PBES2Cipher struct {
+	Cipher PBES2Encryption
+	KDF    PBES2KDF
+}
+
+const (
+	pbkdf2Iterations = 100000
+	scryptN          = 1 << 14
+	scryptR          = 8
+	scryptP          = 1
+	saltSize         = 16
+)
+
+// Limits on the key derivation parameters accepted when decrypting,
+// so that a hostile key file cannot cause excessive CPU or memory use.
+const (
+	maxPBKDF2Iterations = 10000000
+	maxScryptMemory     = 256 << 20
+	maxScryptP          = 16
+)
+
+var (
+	oidPBES2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidScrypt         = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11591, 4, 11}
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}
+	oidHMACWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+)
+
+type pbes2CipherInfo struct {
+	oid     asn1.ObjectIdentifier
+	keySize int
+	gcm     bool
+}
+
+var pbes2Ciphers = map[PBES2Encryption]pbes2CipherInfo{
+	AES128CBC: {asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}, 16, false},
+	AES192CBC: {asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}, 24, false},
+	AES256CBC: {asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}, 32, false},
+	AES128GCM: {asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 6}, 16, true},
+	AES192GCM: {asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 26}, 24, true},
+	AES256GCM: {asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 46}, 32, true},
+}
+
+var prfs = map[string]func() hash.Hash{
+	oidHMACWithSHA1.String():   sha1.New,
+	oidHMACWithSHA256.String(): sha256.New,
+	oidHMACWithSHA384.String(): sha512.New384,
+	oidHMACWithSHA512.String(): sha512.New,
+}
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+type scryptParams struct {
+	Salt                     []byte
+	CostParameter            int
+	BlockSize                int
+	ParallelizationParameter int
+	KeyLength                int `asn1:"optional"`
+}
+
+type gcmParams struct {
+	Nonce  []byte
+	ICVLen int `asn1:"optional,default:12"`
+}
+
+func (c PBES2Cipher) encryptPEMBlock(b *pem.Block, passphrase []byte) (*pem.Block, error) {
+	info, ok := pbes2Ciphers[c.Cipher]
+	if !ok {
+		return nil, errgo.Newf("unsupported PBES2 cipher %d", c.Cipher)
+	}
+	data, err := pkcs8Data(b)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, errgo.Notef(err, "cannot generate salt")
+	}
+	var kdf pkix.AlgorithmIdentifier
+	var key []byte
+	switch c.KDF {
+	case PBKDF2:
+		kdf.Algorithm = oidPBKDF2
+		kdf.Parameters, err = marshalRawValue(pbkdf2Params{
+			Salt:           salt,
+			IterationCount: pbkdf2Iterations,
+			PRF: pkix.AlgorithmIdentifier{
+				Algorithm:  oidHMACWithSHA256,
+				Parameters: asn1.NullRawValue,
+			},
+		})
+		key = pbkdf2.Key(passphrase, salt, pbkdf2Iterations, info.keySize, sha256.New)
+	case Scrypt:
+		kdf.Algorithm = oidScrypt
+		kdf.Parameters, err = marshalRawValue(scryptParams{
+			Salt:                     salt,
+			CostParameter:            scryptN,
+			BlockSize:                scryptR,
+			ParallelizationParameter: scryptP,
+		})
+		if err == nil {
+			key, err = scrypt.Key(passphrase, salt, scryptN, scryptR, scryptP, info.keySize)
+		}
+	default:
+		return nil, errgo.Newf("unsupported PBES2 key derivation function %d", c.KDF)
+	}
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot derive key")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	enc := pkix.AlgorithmIdentifier{
+		Algorithm: info.oid,
+	}
+	var encrypted []byte
+	if info.gcm {
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, errgo.Mask(err)
+		}
+		nonce := make([]byte, aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return nil, errgo.Notef(err, "cannot generate nonce")
+		}
+		enc.Parameters, err = marshalRawValue(gcmParams{
+			Nonce:  nonce,
+			ICVLen: aead.Overhead(),
+		})
+		if err != nil {
+			return nil, errgo.Mask(err)
+		}
+		encrypted = aead.Seal(nil, nonce, data, nil)
+	} else {
+		iv := make([]byte, block.BlockSize())
+		if _, err := rand.Read(iv); err != nil {
+			return nil, errgo.Notef(err, "cannot generate IV")
+		}
+		enc.Parameters, err = marshalRawValue(iv)
+		if err != nil {
+			return nil, errgo.Mask(err)
+		}
+		pad := block.BlockSize() - len(data)%block.BlockSize()
+		encrypted = make([]byte, len(data), len(data)+pad)
+		copy(encrypted, data)
+		for i := 0; i < pad; i++ {
+			encrypted = append(encrypted, byte(pad))
+		}
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, encrypted)
+	}
+	params, err := marshalRawValue(pbes2Params{
+		KeyDerivationFunc: kdf,
+		EncryptionScheme:  enc,
+	})
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	der, err := asn1.Marshal(encryptedPrivateKeyInfo{
+		Algorithm: pkix.AlgorithmIdentifier{
+			Algorithm:  oidPBES2,
+			Parameters: params,
+		},
+		EncryptedData: encrypted,
+	})
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot marshal encrypted key")
+	}
+	return &pem.Block{
+		Type:  "ENCRYPTED PRIVATE KEY",
+		Bytes: der,
+	}, nil
+}
+
+// pkcs8Data returns the PKCS#8 encoding of the private key in b,
+// converting it from a legacy encoding if necessary.
+func pkcs8Data(b *pem.Block) ([]byte, error) {
+	if b.Type == "PRIVATE KEY" {
+		return b.Bytes, nil
+	}
+	key, err := UnmarshalKey(b)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	data, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot marshal key")
+	}
+	return data, nil
+}
+
+func decryptPKCS8PEMBlock(b *pem.Block, passphrase []byte) (*pem.Block, error) {
+	var epki encryptedPrivateKeyInfo
+	if err := unmarshalDER(b.Bytes, &epki); err != nil {
+		return nil, errgo.Notef(err, "invalid encrypted private key")
+	}
+	if !epki.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, errgo.Newf("unsupported encryption algorithm %s", epki.Algorithm.Algorithm)
+	}
+	var params pbes2Params
+	if err := unmarshalDER(epki.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, errgo.Notef(err, "invalid PBES2 parameters")
+	}
+	var info pbes2CipherInfo
+	for _, ci := range pbes2Ciphers {
+		if ci.oid.Equal(params.EncryptionScheme.Algorithm) {
+			info = ci
+		}
+	}
+	if info.oid == nil {
+		return nil, errgo.Newf("unsupported PBES2 cipher %s", params.EncryptionScheme.Algorithm)
+	}
+	key, err := pbes2Key(params.KeyDerivationFunc, passphrase, info.keySize)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	var data []byte
+	if info.gcm {
+		var gp gcmParams
+		if err := unmarshalDER(params.EncryptionScheme.Parameters.FullBytes, &gp); err != nil {
+			return nil, errgo.Notef(err, "invalid GCM parameters")
+		}
+		var aead cipher.AEAD
+		switch {
+		case len(gp.Nonce) == 12:
+			aead, err = cipher.NewGCMWithTagSize(block, gp.ICVLen)
+		case gp.ICVLen == 16:
+			aead, err = cipher.NewGCMWithNonceSize(block, len(gp.Nonce))
+		default:
+			err = errgo.New("unsupported nonce and tag size")
+		}
+		if err != nil {
+			return nil, errgo.Notef(err, "invalid GCM parameters")
+		}
+		data, err = aead.Open(nil, gp.Nonce, epki.EncryptedData, nil)
+		if err != nil {
+			return nil, x509.IncorrectPasswordError
+		}
+	} else {
+		var iv []byte
+		if err := unmarshalDER(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+			return nil, errgo.Notef(err, "invalid IV")
+		}
+		if len(iv) != block.BlockSize() {
+			return nil, errgo.New("invalid IV")
+		}
+		if len(epki.EncryptedData) == 0 || len(epki.EncryptedData)%block.BlockSize() != 0 {
+			return nil, errgo.New("invalid encrypted data length")
+		}
+		data = make([]byte, len(epki.EncryptedData))
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(data, epki.EncryptedData)
+		pad := int(data[len(data)-1])
+		if pad == 0 || pad > block.BlockSize() {
+			return nil, x509.IncorrectPasswordError
+		}
+		for _, p := range data[len(data)-pad:] {
+			if subtle.ConstantTimeByteEq(p, byte(pad)) == 0 {
+				return nil, x509.IncorrectPasswordError
+			}
+		}
+		data = data[:len(data)-pad]
+	}
+	return &pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: data,
+	}, nil
+}
+
+func pbes2Key(kdf pkix.AlgorithmIdentifier, passphrase []byte, keySize int) ([]byte, error) {
+	switch {
+	case kdf.Algorithm.Equal(oidPBKDF2):
+		var p pbkdf2Params
+		if err := unmarshalDER(kdf.Parameters.FullBytes, &p); err != nil {
+			return nil, errgo.Notef(err, "invalid PBKDF2 parameters")
+		}
+		if p.KeyLength != 0 && p.KeyLength != keySize {
+			return nil, errgo.Newf("invalid PBKDF2 key length %d", p.KeyLength)
+		}
+		prf := sha1.New
+		if len(p.PRF.Algorithm) > 0 {
+			var ok bool
+			prf, ok = prfs[p.PRF.Algorithm.String()]
+			if !ok {
+				return nil, errgo.Newf("unsupported PBKDF2 PRF %s", p.PRF.Algorithm)
+			}
+		}
+		if p.IterationCount < 1 || p.IterationCount > maxPBKDF2Iterations {
+			return nil, errgo.Newf("unsupported PBKDF2 iteration count %d", p.IterationCount)
+		}
+		return pbkdf2.Key(passphrase, p.Salt, p.IterationCount, keySize, prf), nil
+	case kdf.Algorithm.Equal(oidScrypt):
+		var p scryptParams
+		if err := unmarshalDER(kdf.Parameters.FullBytes, &p); err != nil {
+			return nil, errgo.Notef(err, "invalid scrypt parameters")
+		}
+		if p.KeyLength != 0 && p.KeyLength != keySize {
+			return nil, errgo.Newf("invalid scrypt key length %d", p.KeyLength)
+		}
+		if p.ParallelizationParameter < 1 || p.ParallelizationParameter > maxScryptP {
+			return nil, errgo.Newf("unsupported scrypt parallelization parameter %d", p.ParallelizationParameter)
+		}
+		// scrypt uses 128*N*r bytes of memory for its working area
+		// and 128*r*p bytes for its output. Limiting the latter
+		// also ensures that r*p < 2^30, as scrypt requires.
+		if p.CostParameter < 2 || p.BlockSize < 1 ||
+			p.CostParameter > maxScryptMemory/128/p.BlockSize ||
+			p.BlockSize > maxScryptMemory/128/p.ParallelizationParameter {
+			return nil, errgo.Newf("unsupported scrypt parameters N=%d r=%d p=%d", p.CostParameter, p.BlockSize, p.ParallelizationParameter)
+		}
+		key, err := scrypt.Key(passphrase, p.Salt, p.CostParameter, p.BlockSize, p.ParallelizationParameter, keySize)
+		if err != nil {
+			return nil, errgo.Notef(err, "cannot derive key")
+		}
+		return key, nil
+	default:
+		return nil, errgo.Newf("unsupported key derivation function %s", kdf.Algorithm)
+	}
+}
+
+func marshalRawValue(v interface{}) (asn1.RawValue, error) {
+	data, err := asn1.Marshal(v)
+	if err != nil {
+		return asn1.RawValue{}, errgo.Mask(err)
+	}
+	return asn1.RawValue{FullBytes: data}, nil
+}
+
+// unmarshalDER unmarshals data into v, which must be completely
+// consumed.
+func unmarshalDER(data []byte, v interface{}) error {
+	rest, err := asn1.Unmarshal(data, v)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	if len(rest) > 0 {
+		return errgo.New("trailing data")
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package ca
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/elliptic"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"testing"
+)
+
+type testPassphrase string
+
+func (p testPassphrase) GetPassphrase(context.Context) ([]byte, error) {
+	return []byte(p), nil
+}
+
+func TestPBES2RoundTrip(t *testing.T) {
+	ctx := context.Background()
+	key, err := GenerateECDSAKey(elliptic.P256())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for c := range pbes2Ciphers {
+		for _, kdf := range []PBES2KDF{PBKDF2, Scrypt} {
+			alg := PBES2Cipher{Cipher: c, KDF: kdf}
+			var buf bytes.Buffer
+			if err := WriteKey(ctx, &buf, key, KeyFormatLegacy, testPassphrase("secret"), alg); err != nil {
+				t.Fatalf("%v: WriteKey: %v", alg, err)
+			}
+			key2, err := ReadKey(ctx, bytes.NewReader(buf.Bytes()), testPassphrase("secret"))
+			if err != nil {
+				t.Errorf("%v: ReadKey: %v", alg, err)
+				continue
+			}
+			if !key2.(interface{ Equal(crypto.PrivateKey) bool }).Equal(key) {
+				t.Errorf("%v: key does not round trip", alg)
+			}
+			if _, err := ReadKey(ctx, bytes.NewReader(buf.Bytes()), testPassphrase("wrong")); err == nil {
+				t.Errorf("%v: key decrypted with wrong passphrase", alg)
+			}
+		}
+	}
+}
+
+func TestGCMParamsDefaultICVLen(t *testing.T) {
+	der, err := asn1.Marshal(struct{ Nonce []byte }{make([]byte, 12)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gp gcmParams
+	if err := unmarshalDER(der, &gp); err != nil {
+		t.Fatalf("cannot unmarshal GCM parameters without ICV length: %v", err)
+	}
+	if gp.ICVLen != 12 {
+		t.Errorf("got ICV length %d, want 12", gp.ICVLen)
+	}
+}
+
+func TestPBES2KeyLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		oid    asn1.ObjectIdentifier
+		params interface{}
+	}{{
+		name:   "PBKDF2 iterations",
+		oid:    oidPBKDF2,
+		params: pbkdf2Params{Salt: []byte("salt"), IterationCount: maxPBKDF2Iterations + 1},
+	}, {
+		name:   "PBKDF2 zero iterations",
+		oid:    oidPBKDF2,
+		params: pbkdf2Params{Salt: []byte("salt"), IterationCount: 0},
+	}, {
+		name:   "scrypt N",
+		oid:    oidScrypt,
+		params: scryptParams{Salt: []byte("salt"), CostParameter: 1 << 30, BlockSize: 8, ParallelizationParameter: 1},
+	}, {
+		name:   "scrypt r",
+		oid:    oidScrypt,
+		params: scryptParams{Salt: []byte("salt"), CostParameter: 1 << 14, BlockSize: 1 << 20, ParallelizationParameter: 1},
+	}, {
+		name:   "scrypt p",
+		oid:    oidScrypt,
+		params: scryptParams{Salt: []byte("salt"), CostParameter: 1 << 14, BlockSize: 8, ParallelizationParameter: 1 << 20},
+	}, {
+		name:   "scrypt r*p",
+		oid:    oidScrypt,
+		params: scryptParams{Salt: []byte("salt"), CostParameter: 2, BlockSize: 1 << 20, ParallelizationParameter: 16},
+	}}
+	for _, test := range tests {
+		params, err := marshalRawValue(test.params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		kdf := pkix.AlgorithmIdentifier{Algorithm: test.oid, Parameters: params}
+		if _, err := pbes2Key(kdf, []byte("secret"), 16); err == nil {
+			t.Errorf("%s: expected error", test.name)
+		}
+	}
+}
+
+func TestDecryptPEMBlockWrongPassphrase(t *testing.T) {
+	ctx := context.Background()
+	key, err := GenerateEd25519Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = WriteKey(ctx, &buf, key, KeyFormatPKCS8, testPassphrase("secret"), PBES2Cipher{Cipher: AES256CBC})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ReadPEM(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncryptedPEMBlock(b) {
+		t.Errorf("block %q not recognised as encrypted", b.Type)
+	}
+	if _, err := DecryptPEMBlock(ctx, b, testPassphrase("wrong")); err == nil {
+		t.Errorf("block decrypted with wrong passphrase")
+	}
+	if _, err := DecryptPEMBlock(ctx, b, testPassphrase("secret")); err != nil {
+		t.Errorf("cannot decrypt block: %v", err)
+	}
+}
@@ -0,0 +1,418 @@
+package ca
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	errgo "gopkg.in/errgo.v1"
+)
+
+// A Profile describes the properties of certificates issued by an
+// Issuer.
+type Profile struct {
+	// Validity is the length of time for which issued certificates
+	// are valid. If it is zero DefaultValidity is used.
+	Validity time.Duration
+
+	// IsCA specifies whether issued certificates may sign other
+	// certificates.
+	IsCA bool
+
+	// MaxPathLen and MaxPathLenZero have the same meaning as the
+	// fields of the same name in x509.Certificate.
+	MaxPathLen     int
+	MaxPathLenZero bool
+
+	KeyUsage           x509.KeyUsage
+	ExtKeyUsage        []x509.ExtKeyUsage
+	UnknownExtKeyUsage []asn1.ObjectIdentifier
+
+	// NameConstraints holds the name constraints added to issued CA
+	// certificates.
+	NameConstraints NameConstraints
+
+	// AllowedSANs holds the types of subject alternative name that
+	// may be requested. If it is nil then all types are allowed.
+	AllowedSANs []SANType
+
+	// SPIFFE specifies that any URI subject alternative names must
+	// be valid SPIFFE IDs.
+	SPIFFE bool
+
+	// Extensions determines which extensions requested in a
+	// certificate signing request are copied to the issued
+	// certificate.
+	Extensions ExtensionPolicy
+
+	// CRLDistributionPoints, OCSPServers and IssuingCertificateURLs
+	// hold the URLs at which clients can find revocation
+	// information and the issuing certificate. They are added to
+	// every issued certificate.
+	CRLDistributionPoints  []string
+	OCSPServers            []string
+	IssuingCertificateURLs []string
+
+	// PolicyIdentifiers holds the certificate policies added to
+	// issued certificates.
+	PolicyIdentifiers []asn1.ObjectIdentifier
+
+	// ExtraExtensions holds extensions added to issued certificates.
+	// They take precedence over any extensions copied from the
+	// certificate signing request.
+	ExtraExtensions []pkix.Extension
+}
+
+// DefaultValidity is the validity of certificates issued with a profile
+// that does not specify one.
+const DefaultValidity = 30 * 24 * time.Hour
+
+// NameConstraints holds the name constraints for a CA certificate.
+// The fields have the same meaning as the fields of the same name in
+// x509.Certificate.
+type NameConstraints struct {
+	Critical                bool
+	PermittedDNSDomains     []string
+	ExcludedDNSDomains      []string
+	PermittedIPRanges       []*net.IPNet
+	ExcludedIPRanges        []*net.IPNet
+	PermittedEmailAddresses []string
+	ExcludedEmailAddresses  []string
+	PermittedURIDomains     []string
+	ExcludedURIDomains      []string
+}
+
+// SANType is a type of subject alternative name.
+type SANType string
+
+const (
+	SANDNS   SANType = "dns"
+	SANEmail SANType = "email"
+	SANIP    SANType = "ip"
+	SANURI   SANType = "uri"
+)
+
+var builtinProfiles = map[string]Profile{
+	"server": {
+		Validity:    365 * 24 * time.Hour,
+		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		AllowedSANs: []SANType{SANDNS, SANIP, SANURI},
+	},
+	"client": {
+		Validity:    365 * 24 * time.Hour,
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	},
+	"intermediate": {
+		Validity:       5 * 365 * 24 * time.Hour,
+		IsCA:           true,
+		MaxPathLenZero: true,
+		KeyUsage:       x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	},
+	"root": {
+		Validity: 10 * 365 * 24 * time.Hour,
+		IsCA:     true,
+		KeyUsage: x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	},
+}
+
+// BuiltinProfile returns the built-in profile with the given name, one
+// of "server", "client", "intermediate" or "root".
+func BuiltinProfile(name string) (*Profile, error) {
+	p, ok := builtinProfiles[name]
+	if !ok {
+		return nil, errgo.Newf("unknown profile %q", name)
+	}
+	return &p, nil
+}
+
+// Template creates a certificate template from the profile for a
+// certificate valid from the given time.
+func (p *Profile) Template(notBefore time.Time) *x509.Certificate {
+	template := new(x509.Certificate)
+	p.Apply(template, notBefore)
+	return template
+}
+
+// Apply sets the fields in template that are controlled by the
+// profile, for a certificate valid from the given time.
+func (p *Profile) Apply(template *x509.Certificate, notBefore time.Time) {
+	validity := p.Validity
+	if validity == 0 {
+		validity = DefaultValidity
+	}
+	template.NotBefore = notBefore
+	template.NotAfter = notBefore.Add(validity)
+	template.BasicConstraintsValid = true
+	template.IsCA = p.IsCA
+	template.MaxPathLen = p.MaxPathLen
+	template.MaxPathLenZero = p.MaxPathLenZero
+	template.KeyUsage = p.KeyUsage
+	template.ExtKeyUsage = p.ExtKeyUsage
+	template.UnknownExtKeyUsage = p.UnknownExtKeyUsage
+	template.CRLDistributionPoints = p.CRLDistributionPoints
+	template.OCSPServer = p.OCSPServers
+	template.IssuingCertificateURL = p.IssuingCertificateURLs
+	template.PolicyIdentifiers = p.PolicyIdentifiers
+	template.ExtraExtensions = p.ExtraExtensions
+	if p.IsCA {
+		nc := p.NameConstraints
+		template.PermittedDNSDomainsCritical = nc.Critical
+		template.PermittedDNSDomains = nc.PermittedDNSDomains
+		template.ExcludedDNSDomains = nc.ExcludedDNSDomains
+		template.PermittedIPRanges = nc.PermittedIPRanges
+		template.ExcludedIPRanges = nc.ExcludedIPRanges
+		template.PermittedEmailAddresses = nc.PermittedEmailAddresses
+		template.ExcludedEmailAddresses = nc.ExcludedEmailAddresses
+		template.PermittedURIDomains = nc.PermittedURIDomains
+		template.ExcludedURIDomains = nc.ExcludedURIDomains
+	}
+}
+
+// CheckRequest checks that the given certificate signing request only
+// asks for the subject alternative names allowed by the profile.
+func (p *Profile) CheckRequest(csr *x509.CertificateRequest) error {
+	if p.SPIFFE {
+		if err := ValidateSPIFFEURIs(csr.URIs); err != nil {
+			return errgo.Mask(err)
+		}
+	}
+	if p.AllowedSANs == nil {
+		return nil
+	}
+	requested := map[SANType]bool{
+		SANDNS:   len(csr.DNSNames) > 0,
+		SANEmail: len(csr.EmailAddresses) > 0,
+		SANIP:    len(csr.IPAddresses) > 0,
+		SANURI:   len(csr.URIs) > 0,
+	}
+	for _, t := range p.AllowedSANs {
+		delete(requested, t)
+	}
+	for t, ok := range requested {
+		if ok {
+			return errgo.Newf("subject alternative names of type %s not allowed", t)
+		}
+	}
+	return nil
+}
+
+func ReadProfileFile(path string) (*Profile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot open %s", path)
+	}
+	defer f.Close()
+	p, err := ReadProfile(f)
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot read profile from %s", path)
+	}
+	return p, nil
+}
+
+func ReadProfile(r io.Reader) (*Profile, error) {
+	var p Profile
+	if err := json.NewDecoder(r).Decode(&p); err != nil {
+		return nil, errgo.Mask(err)
+	}
+	return &p, nil
+}
+
+type profileJSON struct {
+	Validity          string               `json:"validity"`
+	IsCA              bool                 `json:"is-ca"`
+	MaxPathLen        *int                 `json:"max-path-len"`
+	KeyUsage          []string             `json:"key-usage"`
+	ExtKeyUsage       []string             `json:"ext-key-usage"`
+	NameConstraints   *nameConstraintsJSON `json:"name-constraints"`
+	AllowedSANs       []SANType            `json:"allowed-sans"`
+	SPIFFE            bool                 `json:"spiffe"`
+	ExtensionPolicy   ExtensionMode        `json:"extension-policy"`
+	AllowedExtensions []string             `json:"allowed-extensions"`
+	CRLURLs           []string             `json:"crl-distribution-points"`
+	OCSPURLs          []string             `json:"ocsp-servers"`
+	IssuerURLs        []string             `json:"issuing-certificate-urls"`
+	Policies          []string             `json:"policies"`
+	Extensions        []extensionJSON      `json:"extensions"`
+}
+
+type extensionJSON struct {
+	OID      string `json:"oid"`
+	Critical bool   `json:"critical"`
+	Value    string `json:"value"`
+}
+
+type nameConstraintsJSON struct {
+	Critical                bool     `json:"critical"`
+	PermittedDNSDomains     []string `json:"permitted-dns-domains"`
+	ExcludedDNSDomains      []string `json:"excluded-dns-domains"`
+	PermittedIPRanges       []string `json:"permitted-ip-ranges"`
+	ExcludedIPRanges        []string `json:"excluded-ip-ranges"`
+	PermittedEmailAddresses []string `json:"permitted-email-addresses"`
+	ExcludedEmailAddresses  []string `json:"excluded-email-addresses"`
+	PermittedURIDomains     []string `json:"permitted-uri-domains"`
+	ExcludedURIDomains      []string `json:"excluded-uri-domains"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler. Key usages and extended
+// key usages are specified by name, validity as a duration such as
+// "8760h" or a number of days such as "365d" and IP ranges in CIDR
+// notation. Extension values are in the form accepted by
+// ParseExtensionValue.
+func (p *Profile) UnmarshalJSON(data []byte) error {
+	var pj profileJSON
+	if err := json.Unmarshal(data, &pj); err != nil {
+		return err
+	}
+	var np Profile
+	var err error
+	if pj.Validity != "" {
+		np.Validity, err = parseValidity(pj.Validity)
+		if err != nil {
+			return errgo.Mask(err)
+		}
+	}
+	np.IsCA = pj.IsCA
+	if pj.MaxPathLen != nil && *pj.MaxPathLen >= 0 {
+		np.MaxPathLen = *pj.MaxPathLen
+		np.MaxPathLenZero = np.MaxPathLen == 0
+	}
+	for _, s := range pj.KeyUsage {
+		ku, err := ParseKeyUsage(s)
+		if err != nil {
+			return errgo.Mask(err)
+		}
+		np.KeyUsage |= ku
+	}
+	for _, s := range pj.ExtKeyUsage {
+		eku, oid, err := ParseExtKeyUsage(s)
+		if err != nil {
+			return errgo.Mask(err)
+		}
+		if oid != nil {
+			np.UnknownExtKeyUsage = append(np.UnknownExtKeyUsage, oid)
+		} else {
+			np.ExtKeyUsage = append(np.ExtKeyUsage, eku)
+		}
+	}
+	if nc := pj.NameConstraints; nc != nil {
+		np.NameConstraints = NameConstraints{
+			Critical:                nc.Critical,
+			PermittedDNSDomains:     nc.PermittedDNSDomains,
+			ExcludedDNSDomains:      nc.ExcludedDNSDomains,
+			PermittedEmailAddresses: nc.PermittedEmailAddresses,
+			ExcludedEmailAddresses:  nc.ExcludedEmailAddresses,
+			PermittedURIDomains:     nc.PermittedURIDomains,
+			ExcludedURIDomains:      nc.ExcludedURIDomains,
+		}
+		np.NameConstraints.PermittedIPRanges, err = parseIPRanges(nc.PermittedIPRanges)
+		if err != nil {
+			return errgo.Mask(err)
+		}
+		np.NameConstraints.ExcludedIPRanges, err = parseIPRanges(nc.ExcludedIPRanges)
+		if err != nil {
+			return errgo.Mask(err)
+		}
+	}
+	for _, t := range pj.AllowedSANs {
+		switch t {
+		case SANDNS, SANEmail, SANIP, SANURI:
+		default:
+			return errgo.Newf("unknown subject alternative name type %q", t)
+		}
+	}
+	np.AllowedSANs = pj.AllowedSANs
+	np.SPIFFE = pj.SPIFFE
+	switch pj.ExtensionPolicy {
+	case "", ExtensionsIgnore, ExtensionsCopy, ExtensionsAllow, ExtensionsReject:
+	default:
+		return errgo.Newf("unknown extension policy %q", pj.ExtensionPolicy)
+	}
+	np.Extensions.Mode = pj.ExtensionPolicy
+	for _, s := range pj.AllowedExtensions {
+		oid, err := ParseOID(s)
+		if err != nil {
+			return errgo.Mask(err)
+		}
+		np.Extensions.Allowed = append(np.Extensions.Allowed, oid)
+	}
+	for _, urls := range [][]string{pj.CRLURLs, pj.OCSPURLs, pj.IssuerURLs} {
+		if err := checkURLs(urls); err != nil {
+			return errgo.Mask(err)
+		}
+	}
+	np.CRLDistributionPoints = pj.CRLURLs
+	np.OCSPServers = pj.OCSPURLs
+	np.IssuingCertificateURLs = pj.IssuerURLs
+	for _, s := range pj.Policies {
+		oid, err := ParseOID(s)
+		if err != nil {
+			return errgo.Mask(err)
+		}
+		np.PolicyIdentifiers = append(np.PolicyIdentifiers, oid)
+	}
+	for _, e := range pj.Extensions {
+		ext := pkix.Extension{Critical: e.Critical}
+		ext.Id, err = ParseOID(e.OID)
+		if err != nil {
+			return errgo.Mask(err)
+		}
+		if containsExtension(np.ExtraExtensions, ext.Id) {
+			return errgo.Newf("duplicate extension %s", ext.Id)
+		}
+		ext.Value, err = ParseExtensionValue(e.Value)
+		if err != nil {
+			return errgo.Notef(err, "invalid value for extension %s", ext.Id)
+		}
+		np.ExtraExtensions = append(np.ExtraExtensions, ext)
+	}
+	*p = np
+	return nil
+}
+
+func parseValidity(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		n, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, errgo.Newf("invalid validity %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, errgo.Newf("invalid validity %q", s)
+	}
+	return d, nil
+}
+
+func parseIPRanges(ss []string) ([]*net.IPNet, error) {
+	var ranges []*net.IPNet
+	for _, s := range ss {
+		_, ipnet, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, errgo.Newf("invalid IP range %q", s)
+		}
+		ranges = append(ranges, ipnet)
+	}
+	return ranges, nil
+}
+
+// checkURLs checks that each of the given strings is an absolute URL.
+func checkURLs(ss []string) error {
+	for _, s := range ss {
+		u, err := url.Parse(s)
+		if err != nil || !u.IsAbs() {
+			return errgo.Newf("invalid URL %q", s)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package ca
+
+import (
+	"crypto/x509"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadProfile(t *testing.T) {
+	p, err := ReadProfile(strings.NewReader(`{
+		"validity": "90d",
+		"key-usage": ["digitalSignature"],
+		"ext-key-usage": ["serverAuth", "1.2.3.4"],
+		"allowed-sans": ["dns"],
+		"ocsp-servers": ["http://ocsp.example.com/"],
+		"policies": ["2.23.140.1.2.1"],
+		"extensions": [{"oid": "1.2.3.5", "critical": true, "value": "asn1:UTF8String:x"}]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	template := p.Template(now)
+	if got := template.NotAfter.Sub(template.NotBefore); got != 90*24*time.Hour {
+		t.Errorf("got validity %v, want 90 days", got)
+	}
+	if template.KeyUsage != x509.KeyUsageDigitalSignature {
+		t.Errorf("got key usage %v", template.KeyUsage)
+	}
+	if len(template.ExtKeyUsage) != 1 || len(template.UnknownExtKeyUsage) != 1 {
+		t.Errorf("got extended key usages %v %v", template.ExtKeyUsage, template.UnknownExtKeyUsage)
+	}
+	if len(template.OCSPServer) != 1 || len(template.PolicyIdentifiers) != 1 {
+		t.Errorf("got OCSP servers %v and policies %v", template.OCSPServer, template.PolicyIdentifiers)
+	}
+	if len(template.ExtraExtensions) != 1 || !template.ExtraExtensions[0].Critical {
+		t.Errorf("got extensions %v", template.ExtraExtensions)
+	}
+}
+
+func TestProfileDefaultValidity(t *testing.T) {
+	p, err := ReadProfile(strings.NewReader(`{"key-usage": ["digitalSignature"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := p.Template(time.Now())
+	if got := template.NotAfter.Sub(template.NotBefore); got != DefaultValidity {
+		t.Errorf("got validity %v, want %v", got, DefaultValidity)
+	}
+}
+
+func TestReadProfileErrors(t *testing.T) {
+	for _, s := range []string{
+		`{"validity": "soon"}`,
+		`{"key-usage": ["everything"]}`,
+		`{"allowed-sans": ["phone"]}`,
+		`{"ocsp-servers": ["ocsp"]}`,
+		`{"policies": ["x"]}`,
+		`{"extensions": [{"oid": "1.2.3", "value": "asn1:NULL"}, {"oid": "1.2.3", "value": "asn1:NULL"}]}`,
+	} {
+		if _, err := ReadProfile(strings.NewReader(s)); err == nil {
+			t.Errorf("%s: expected error", s)
+		}
+	}
+}
@@ -0,0 +1,418 @@
+// Package server implements an HTTP/JSON API for issuing certificates
+// with a ca.Issuer.
+//
+// The API has the following endpoints:
+//
+//	POST /sign                  sign a certificate signing request
+//	GET  /ca                    the CA certificate and its chain
+//	GET  /crl                   the current CRL
+//	GET  /certificates/{serial} an issued certificate
+//
+// The sign and certificates endpoints require the caller to be
+// authenticated, either with a bearer token sent over TLS or with a
+// TLS client certificate.
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	errgo "gopkg.in/errgo.v1"
+
+	"github.com/mhilton/ca"
+)
+
+// maxRequestSize is the maximum size of a request body that will be
+// read.
+const maxRequestSize = 64 * 1024
+
+// Params holds the parameters for a Server.
+type Params struct {
+	// Issuer is used to issue certificates.
+	Issuer *ca.Issuer
+
+	// Profiles holds the profiles that callers may request, keyed
+	// by name.
+	Profiles map[string]*ca.Profile
+
+	// Callers holds the callers allowed to use the server.
+	Callers []Caller
+
+	// Store, if set, holds the certificates issued by Issuer. It is
+	// required by the certificates and CRL endpoints, and must be a
+	// ca.CRLNumberStore so that CRL numbers can be allocated.
+	Store ca.Store
+
+	// CRLValidity is the time for which generated CRLs are valid.
+	// A new CRL is generated once half of this time has passed. If
+	// it is zero a day is used.
+	CRLValidity time.Duration
+
+	// Logf, if set, is called to log each certificate issued and
+	// each failed attempt to issue one, along with the name of the
+	// caller.
+	Logf func(format string, args ...interface{})
+}
+
+// A Caller describes a client of the server and what it may do.
+type Caller struct {
+	// Name identifies the caller in logs.
+	Name string `json:"name"`
+
+	// Token, if set, is a bearer token that authenticates the
+	// caller. Tokens are only accepted on TLS connections.
+	Token string `json:"token"`
+
+	// Subject and SAN, if either is set, authenticate a caller that
+	// presents a verified TLS client certificate that has not been
+	// revoked. Subject must match the certificate's distinguished
+	// name, as formatted by pkix.Name.String, and SAN must match one
+	// of its subject alternative names. If both are set both must
+	// match.
+	Subject string `json:"subject"`
+	SAN     string `json:"san"`
+
+	// Profiles holds the names of the profiles the caller may
+	// request certificates with.
+	Profiles []string `json:"profiles"`
+}
+
+// A Server is an http.Handler that implements the signing API.
+type Server struct {
+	p   Params
+	mux *http.ServeMux
+
+	mu      sync.Mutex
+	crl     []byte
+	crlTime time.Time
+}
+
+// New creates a new Server.
+func New(p Params) (*Server, error) {
+	if p.Issuer == nil {
+		return nil, errgo.New("no issuer specified")
+	}
+	for _, c := range p.Callers {
+		if c.Token == "" && c.Subject == "" && c.SAN == "" {
+			return nil, errgo.Newf("caller %q has no credentials", c.Name)
+		}
+		for _, name := range c.Profiles {
+			if p.Profiles[name] == nil {
+				return nil, errgo.Newf("caller %q has unknown profile %q", c.Name, name)
+			}
+		}
+	}
+	if p.Store != nil {
+		if _, ok := p.Store.(ca.CRLNumberStore); !ok {
+			return nil, errgo.New("store cannot allocate CRL numbers")
+		}
+	}
+	if p.CRLValidity == 0 {
+		p.CRLValidity = 24 * time.Hour
+	}
+	s := &Server{
+		p:   p,
+		mux: http.NewServeMux(),
+	}
+	s.mux.HandleFunc("/sign", s.serveSign)
+	s.mux.HandleFunc("/ca", s.serveCA)
+	s.mux.HandleFunc("/crl", s.serveCRL)
+	s.mux.HandleFunc("/certificates/", s.serveCertificate)
+	return s, nil
+}
+
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.p.Logf != nil {
+		s.p.Logf(format, args...)
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.mux.ServeHTTP(w, req)
+}
+
+// SignRequest is the body of a request to the sign endpoint.
+type SignRequest struct {
+	// CSR holds the PEM encoded certificate signing request.
+	CSR string `json:"csr"`
+
+	// Profile holds the name of the profile with which to issue
+	// the certificate.
+	Profile string `json:"profile"`
+}
+
+// SignResponse is the body of a successful response from the sign
+// endpoint.
+type SignResponse struct {
+	// Certificate holds the PEM encoded certificate.
+	Certificate string `json:"certificate"`
+
+	// Chain holds the PEM encoded certificates that link the
+	// certificate to a root.
+	Chain string `json:"chain"`
+}
+
+// Error is the body of an error response.
+type Error struct {
+	Message string `json:"message"`
+}
+
+func (s *Server) serveSign(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	c, err := s.authenticate(req)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if c == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	var sr SignRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxRequestSize)).Decode(&sr); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request: "+err.Error())
+		return
+	}
+	if !contains(c.Profiles, sr.Profile) {
+		writeError(w, http.StatusForbidden, "profile \""+sr.Profile+"\" not allowed")
+		return
+	}
+	csr, err := ca.ReadCertificateRequest(strings.NewReader(sr.CSR))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid certificate signing request: "+err.Error())
+		return
+	}
+	crt, err := s.p.Issuer.Issue(req.Context(), csr, s.p.Profiles[sr.Profile])
+	if err != nil {
+		s.logf("caller %q: cannot issue certificate with profile %q: %v", c.Name, sr.Profile, err)
+		writeError(w, http.StatusBadRequest, "cannot issue certificate: "+err.Error())
+		return
+	}
+	s.logf("caller %q: issued certificate %X for %q with profile %q", c.Name, crt.SerialNumber, crt.Subject, sr.Profile)
+	var resp SignResponse
+	resp.Certificate, err = encodeCertificates(crt)
+	if err == nil {
+		resp.Chain, err = encodeCertificates(s.p.Issuer.Chain()...)
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) serveCA(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	var buf bytes.Buffer
+	if err := ca.WriteCertificates(&buf, s.p.Issuer.Chain()); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/pem-certificate-chain")
+	w.Write(buf.Bytes())
+}
+
+func (s *Server) serveCRL(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if s.p.Store == nil {
+		writeError(w, http.StatusNotFound, "no CRL available")
+		return
+	}
+	crl, err := s.currentCRL(req.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/pkix-crl")
+	w.Write(crl)
+}
+
+// currentCRL returns the DER encoded CRL, generating a new one if the
+// cached one is too old.
+func (s *Server) currentCRL(ctx context.Context) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if s.crl != nil && now.Before(s.crlTime.Add(s.p.CRLValidity/2)) {
+		return s.crl, nil
+	}
+	crt := s.p.Issuer.Certificate()
+	entries, err := ca.RevokedEntries(ctx, s.p.Store, crt)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	number, err := s.p.Store.(ca.CRLNumberStore).NextCRLNumber(ctx, crt, nil)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	crl, err := s.p.Issuer.CreateCRL(ctx, &x509.RevocationList{
+		Number:                    number,
+		ThisUpdate:                now,
+		NextUpdate:                now.Add(s.p.CRLValidity),
+		RevokedCertificateEntries: entries,
+	})
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	s.crl = crl.Raw
+	s.crlTime = now
+	return s.crl, nil
+}
+
+func (s *Server) serveCertificate(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	c, err := s.authenticate(req)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if c == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	if s.p.Store == nil {
+		writeError(w, http.StatusNotFound, "certificate not found")
+		return
+	}
+	serial, ok := new(big.Int).SetString(strings.TrimPrefix(req.URL.Path, "/certificates/"), 16)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid serial number")
+		return
+	}
+	r, err := s.p.Store.Get(req.Context(), serial)
+	if errgo.Cause(err) == ca.ErrNotFound {
+		writeError(w, http.StatusNotFound, "certificate not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	var buf bytes.Buffer
+	if err := ca.WriteCertificate(&buf, r.Certificate); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-pem-file")
+	w.Write(buf.Bytes())
+}
+
+// authenticate returns the caller that made the given request, or nil
+// if the caller could not be authenticated.
+func (s *Server) authenticate(req *http.Request) (*Caller, error) {
+	if h := req.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		if req.TLS == nil {
+			// Don't accept tokens that may have been seen by
+			// anyone on the network.
+			return nil, nil
+		}
+		token := sha256.Sum256([]byte(strings.TrimPrefix(h, "Bearer ")))
+		for i, c := range s.p.Callers {
+			if c.Token == "" {
+				continue
+			}
+			// Compare hashes so that the comparison takes the
+			// same time whatever the length of the token.
+			want := sha256.Sum256([]byte(c.Token))
+			if subtle.ConstantTimeCompare(token[:], want[:]) == 1 {
+				return &s.p.Callers[i], nil
+			}
+		}
+		return nil, nil
+	}
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 {
+		return nil, nil
+	}
+	crt := req.TLS.VerifiedChains[0][0]
+	var caller *Caller
+	for i, c := range s.p.Callers {
+		if c.Subject == "" && c.SAN == "" {
+			continue
+		}
+		if c.Subject != "" && c.Subject != crt.Subject.String() {
+			continue
+		}
+		if c.SAN != "" && !(ca.Query{SAN: c.SAN}).Match(crt) {
+			continue
+		}
+		caller = &s.p.Callers[i]
+		break
+	}
+	if caller == nil {
+		return nil, nil
+	}
+	revoked, err := s.revoked(req.Context(), crt)
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot check client certificate")
+	}
+	if revoked {
+		return nil, nil
+	}
+	return caller, nil
+}
+
+// revoked reports whether the given certificate has been revoked. Only
+// certificates issued by the server's issuer and recorded in its store
+// can be checked.
+func (s *Server) revoked(ctx context.Context, crt *x509.Certificate) (bool, error) {
+	if s.p.Store == nil || !bytes.Equal(crt.RawIssuer, s.p.Issuer.Certificate().RawSubject) {
+		return false, nil
+	}
+	r, err := s.p.Store.Get(ctx, crt.SerialNumber)
+	if errgo.Cause(err) == ca.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, errgo.Mask(err)
+	}
+	return r.Revoked, nil
+}
+
+func contains(ss []string, s string) bool {
+	for _, t := range ss {
+		if t == s {
+			return true
+		}
+	}
+	return false
+}
+
+func encodeCertificates(crts ...*x509.Certificate) (string, error) {
+	var buf bytes.Buffer
+	if err := ca.WriteCertificates(&buf, crts); err != nil {
+		return "", errgo.Mask(err)
+	}
+	return buf.String(), nil
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, Error{Message: msg})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
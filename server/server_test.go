@@ -0,0 +1,248 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/elliptic"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mhilton/ca"
+)
+
+func newTestIssuer(t *testing.T) *ca.Issuer {
+	key, err := ca.GenerateECDSAKey(elliptic.P256())
+	if err != nil {
+		t.Fatal(err)
+	}
+	crt, err := ca.SelfSignCertificate(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iss, err := ca.NewIssuer(crt, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return iss
+}
+
+func TestSignLogsCaller(t *testing.T) {
+	iss := newTestIssuer(t)
+	profile, err := ca.BuiltinProfile("server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logs []string
+	srv, err := New(Params{
+		Issuer:   iss,
+		Profiles: map[string]*ca.Profile{"server": profile},
+		Callers: []Caller{{
+			Name:     "test-caller",
+			Token:    "secret",
+			Profiles: []string{"server"},
+		}},
+		Logf: func(format string, args ...interface{}) {
+			logs = append(logs, fmt.Sprintf(format, args...))
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leafKey, err := ca.GenerateECDSAKey(elliptic.P256())
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := ca.SignCertificateRequest(&x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "example.com"},
+		DNSNames: []string{"example.com"},
+	}, leafKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := ca.WriteCertificateRequest(&buf, csr); err != nil {
+		t.Fatal(err)
+	}
+	body, err := json.Marshal(SignRequest{
+		CSR:     buf.String(),
+		Profile: "server",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("POST", "/sign", bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer secret")
+	req.TLS = &tls.ConnectionState{}
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body)
+	}
+	if len(logs) != 1 || !strings.Contains(logs[0], `"test-caller"`) || !strings.Contains(logs[0], "issued certificate") {
+		t.Errorf("unexpected logs %q", logs)
+	}
+}
+
+// plainStore hides any methods of the store other than those of
+// ca.Store.
+type plainStore struct {
+	ca.Store
+}
+
+func TestCRL(t *testing.T) {
+	iss := newTestIssuer(t)
+	db, err := ca.NewDirStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(Params{Issuer: iss, Store: plainStore{db}}); err == nil {
+		t.Errorf("expected error using a store that cannot allocate CRL numbers")
+	}
+	srv, err := New(Params{Issuer: iss, Store: db})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest("GET", "/crl", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body)
+	}
+	crl, err := x509.ParseRevocationList(rec.Body.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if crl.Number.Int64() != 1 {
+		t.Errorf("got CRL number %v, want 1", crl.Number)
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	ctx := context.Background()
+	iss := newTestIssuer(t)
+	db, err := ca.NewDirStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	iss.SetStore(db)
+	key, err := ca.GenerateECDSAKey(elliptic.P256())
+	if err != nil {
+		t.Fatal(err)
+	}
+	issue := func(subject pkix.Name, uri string) *x509.Certificate {
+		crt, err := iss.IssueFor(ctx, key.Public(), &x509.Certificate{
+			Subject:     subject,
+			URIs:        []*url.URL{{Scheme: "spiffe", Host: "example.com", Path: uri}},
+			NotBefore:   time.Now(),
+			NotAfter:    time.Now().Add(time.Hour),
+			KeyUsage:    x509.KeyUsageDigitalSignature,
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return crt
+	}
+	alice := issue(pkix.Name{CommonName: "alice", Organization: []string{"Example"}}, "/alice")
+	mallory := issue(pkix.Name{CommonName: "alice", Organization: []string{"Other"}}, "/mallory")
+	bob := issue(pkix.Name{CommonName: "bob"}, "/bob")
+	revoked := issue(pkix.Name{CommonName: "bob"}, "/bob")
+	if err := db.Revoke(ctx, revoked.SerialNumber, time.Now(), 1); err != nil {
+		t.Fatal(err)
+	}
+	srv, err := New(Params{
+		Issuer: iss,
+		Store:  db,
+		Callers: []Caller{{
+			Name:  "token",
+			Token: "secret",
+		}, {
+			Name:    "alice",
+			Subject: alice.Subject.String(),
+		}, {
+			Name: "bob",
+			SAN:  "spiffe://example.com/bob",
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		about string
+		token string
+		tls   bool
+		crt   *x509.Certificate
+		want  string
+	}{{
+		about: "token without TLS",
+		token: "secret",
+	}, {
+		about: "token",
+		token: "secret",
+		tls:   true,
+		want:  "token",
+	}, {
+		about: "wrong token",
+		token: "wrong",
+		tls:   true,
+	}, {
+		about: "subject",
+		tls:   true,
+		crt:   alice,
+		want:  "alice",
+	}, {
+		about: "same common name",
+		tls:   true,
+		crt:   mallory,
+	}, {
+		about: "SAN",
+		tls:   true,
+		crt:   bob,
+		want:  "bob",
+	}, {
+		about: "revoked",
+		tls:   true,
+		crt:   revoked,
+	}}
+	for _, test := range tests {
+		t.Run(test.about, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/certificates/1", nil)
+			if test.token != "" {
+				req.Header.Set("Authorization", "Bearer "+test.token)
+			}
+			if test.tls {
+				req.TLS = &tls.ConnectionState{}
+				if test.crt != nil {
+					req.TLS.VerifiedChains = [][]*x509.Certificate{{test.crt, iss.Certificate()}}
+				}
+			}
+			c, err := srv.authenticate(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got string
+			if c != nil {
+				got = c.Name
+			}
+			if got != test.want {
+				t.Errorf("got caller %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package ca
+
+import (
+	"net/url"
+	"strings"
+
+	errgo "gopkg.in/errgo.v1"
+)
+
+const maxSPIFFEIDLength = 2048
+
+// ValidateSPIFFEID checks that u is a well-formed SPIFFE ID as defined
+// by the SPIFFE-ID specification. A SPIFFE ID has the form
+// spiffe://trust-domain/path.
+func ValidateSPIFFEID(u *url.URL) error {
+	s := u.String()
+	if len(s) > maxSPIFFEIDLength {
+		return errgo.Newf("invalid SPIFFE ID %q: too long", s)
+	}
+	if u.Scheme != "spiffe" {
+		return errgo.Newf("invalid SPIFFE ID %q: scheme must be spiffe", s)
+	}
+	if u.Opaque != "" || u.User != nil || u.Port() != "" || u.RawQuery != "" || u.ForceQuery || u.Fragment != "" {
+		return errgo.Newf("invalid SPIFFE ID %q: must not contain user info, port, query or fragment", s)
+	}
+	if u.Host == "" {
+		return errgo.Newf("invalid SPIFFE ID %q: missing trust domain", s)
+	}
+	for _, c := range u.Host {
+		if !isSPIFFETrustDomainChar(c) {
+			return errgo.Newf("invalid SPIFFE ID %q: invalid character %q in trust domain", s, c)
+		}
+	}
+	if u.Path == "" {
+		return nil
+	}
+	if u.RawPath != "" {
+		return errgo.Newf("invalid SPIFFE ID %q: path must not be percent-encoded", s)
+	}
+	for _, seg := range strings.Split(u.Path[1:], "/") {
+		switch seg {
+		case "":
+			return errgo.Newf("invalid SPIFFE ID %q: empty path segment", s)
+		case ".", "..":
+			return errgo.Newf("invalid SPIFFE ID %q: relative path segment", s)
+		}
+		for _, c := range seg {
+			if !isSPIFFEPathChar(c) {
+				return errgo.Newf("invalid SPIFFE ID %q: invalid character %q in path", s, c)
+			}
+		}
+	}
+	return nil
+}
+
+func isSPIFFETrustDomainChar(c rune) bool {
+	return c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '.' || c == '-' || c == '_'
+}
+
+func isSPIFFEPathChar(c rune) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '-' || c == '_'
+}
+
+// ValidateSPIFFEURIs checks that uris is suitable for a SPIFFE
+// verifiable identity document, which may contain at most one URI
+// that must be a valid SPIFFE ID.
+func ValidateSPIFFEURIs(uris []*url.URL) error {
+	if len(uris) > 1 {
+		return errgo.New("a SPIFFE certificate may only contain one URI")
+	}
+	for _, u := range uris {
+		if err := ValidateSPIFFEID(u); err != nil {
+			return errgo.Mask(err)
+		}
+	}
+	return nil
+}
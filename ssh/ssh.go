@@ -0,0 +1,172 @@
+// Package ssh issues OpenSSH certificates using the same keys as the
+// rest of the ca package.
+package ssh
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	xssh "golang.org/x/crypto/ssh"
+	errgo "gopkg.in/errgo.v1"
+)
+
+// Certificate types.
+const (
+	UserCert = xssh.UserCert
+	HostCert = xssh.HostCert
+)
+
+// DefaultUserExtensions holds the extensions that ssh-keygen adds to
+// user certificates by default.
+var DefaultUserExtensions = map[string]string{
+	"permit-X11-forwarding":   "",
+	"permit-agent-forwarding": "",
+	"permit-port-forwarding":  "",
+	"permit-pty":              "",
+	"permit-user-rc":          "",
+}
+
+// Params holds the parameters for an SSH certificate.
+type Params struct {
+	// Type is the type of certificate, either UserCert or HostCert.
+	Type uint32
+
+	// KeyID identifies the certificate in server logs.
+	KeyID string
+
+	// Serial is the serial number of the certificate. If it is zero
+	// a random serial number is used.
+	Serial uint64
+
+	// Principals holds the user names or host names for which the
+	// certificate is valid. If it is empty the certificate is
+	// valid for any principal.
+	Principals []string
+
+	// ValidAfter and ValidBefore hold the validity period of the
+	// certificate. A zero ValidBefore means the certificate never
+	// expires.
+	ValidAfter  time.Time
+	ValidBefore time.Time
+
+	// CriticalOptions and Extensions hold the critical options and
+	// extensions of the certificate.
+	CriticalOptions map[string]string
+	Extensions      map[string]string
+}
+
+// SignCertificate creates an SSH certificate for pub signed by key.
+func SignCertificate(key crypto.Signer, pub xssh.PublicKey, p Params) (*xssh.Certificate, error) {
+	if p.Type != UserCert && p.Type != HostCert {
+		return nil, errgo.Newf("invalid certificate type %d", p.Type)
+	}
+	signer, err := newSigner(key)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	serial := p.Serial
+	if serial == 0 {
+		var b [8]byte
+		if _, err := io.ReadFull(rand.Reader, b[:]); err != nil {
+			return nil, errgo.Notef(err, "cannot generate serial number")
+		}
+		serial = binary.BigEndian.Uint64(b[:])
+	}
+	var validAfter uint64
+	if !p.ValidAfter.IsZero() {
+		validAfter = uint64(p.ValidAfter.Unix())
+	}
+	validBefore := uint64(xssh.CertTimeInfinity)
+	if !p.ValidBefore.IsZero() {
+		validBefore = uint64(p.ValidBefore.Unix())
+	}
+	crt := &xssh.Certificate{
+		Key:             pub,
+		Serial:          serial,
+		CertType:        p.Type,
+		KeyId:           p.KeyID,
+		ValidPrincipals: p.Principals,
+		ValidAfter:      validAfter,
+		ValidBefore:     validBefore,
+		Permissions: xssh.Permissions{
+			CriticalOptions: p.CriticalOptions,
+			Extensions:      p.Extensions,
+		},
+	}
+	if err := crt.SignCert(rand.Reader, signer); err != nil {
+		return nil, errgo.Notef(err, "cannot sign certificate")
+	}
+	return crt, nil
+}
+
+// newSigner creates an SSH signer from key. RSA keys sign with SHA-512
+// rather than the deprecated SHA-1.
+func newSigner(key crypto.Signer) (xssh.Signer, error) {
+	signer, err := xssh.NewSignerFromSigner(key)
+	if err != nil {
+		return nil, errgo.Notef(err, "unsupported key")
+	}
+	if _, ok := key.Public().(*rsa.PublicKey); ok {
+		signer, err = xssh.NewSignerWithAlgorithms(signer.(xssh.AlgorithmSigner), []string{xssh.KeyAlgoRSASHA512})
+		if err != nil {
+			return nil, errgo.Mask(err)
+		}
+	}
+	return signer, nil
+}
+
+// PublicKey returns the SSH public key for the given key.
+func PublicKey(key crypto.PublicKey) (xssh.PublicKey, error) {
+	pub, err := xssh.NewPublicKey(key)
+	if err != nil {
+		return nil, errgo.Notef(err, "unsupported key")
+	}
+	return pub, nil
+}
+
+func ReadPublicKeyFile(path string) (xssh.PublicKey, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot open %s", path)
+	}
+	defer f.Close()
+	pub, err := ReadPublicKey(f)
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot read public key from %s", path)
+	}
+	return pub, nil
+}
+
+// ReadPublicKey reads an SSH public key in authorized_keys format, as
+// found in the .pub files written by ssh-keygen.
+func ReadPublicKey(r io.Reader) (xssh.PublicKey, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	pub, _, _, _, err := xssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return nil, errgo.Notef(err, "invalid public key")
+	}
+	return pub, nil
+}
+
+// WriteAuthorizedKey writes pub, which may be a certificate, in
+// authorized_keys format followed by the given comment.
+func WriteAuthorizedKey(w io.Writer, pub xssh.PublicKey, comment string) error {
+	data := bytes.TrimSuffix(xssh.MarshalAuthorizedKey(pub), []byte("\n"))
+	if comment != "" {
+		data = append(data, ' ')
+		data = append(data, comment...)
+	}
+	data = append(data, '\n')
+	_, err := w.Write(data)
+	return errgo.Mask(err)
+}
@@ -0,0 +1,147 @@
+package ssh
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/elliptic"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	xssh "golang.org/x/crypto/ssh"
+
+	"github.com/mhilton/ca"
+)
+
+func TestSignCertificateRoundTrip(t *testing.T) {
+	ecKey, err := ca.GenerateECDSAKey(elliptic.P256())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := ca.GenerateRSAKey(2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edKey, err := ca.GenerateEd25519Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	userKey, err := ca.GenerateEd25519Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := PublicKey(userKey.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().Truncate(time.Second)
+	tests := []struct {
+		about      string
+		key        crypto.Signer
+		wantFormat string
+	}{
+		{"ecdsa", ecKey, xssh.KeyAlgoECDSA256},
+		{"rsa", rsaKey, xssh.KeyAlgoRSASHA512},
+		{"ed25519", edKey, xssh.KeyAlgoED25519},
+	}
+	for _, test := range tests {
+		t.Run(test.about, func(t *testing.T) {
+			p := Params{
+				Type:            UserCert,
+				KeyID:           "test",
+				Principals:      []string{"alice", "bob"},
+				ValidAfter:      now.Add(-5 * time.Minute),
+				ValidBefore:     now.Add(time.Hour),
+				CriticalOptions: map[string]string{"force-command": "/bin/true"},
+				Extensions:      DefaultUserExtensions,
+			}
+			crt, err := SignCertificate(test.key, pub, p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err := WriteAuthorizedKey(&buf, crt, "test"); err != nil {
+				t.Fatal(err)
+			}
+			parsed, err := ReadPublicKey(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, ok := parsed.(*xssh.Certificate)
+			if !ok {
+				t.Fatalf("got %T, want certificate", parsed)
+			}
+			if got.Serial == 0 {
+				t.Errorf("no serial number generated")
+			}
+			if got.CertType != UserCert || got.KeyId != p.KeyID {
+				t.Errorf("got type %d, key ID %q", got.CertType, got.KeyId)
+			}
+			if !reflect.DeepEqual(got.ValidPrincipals, p.Principals) {
+				t.Errorf("got principals %q, want %q", got.ValidPrincipals, p.Principals)
+			}
+			if got.ValidAfter != uint64(p.ValidAfter.Unix()) || got.ValidBefore != uint64(p.ValidBefore.Unix()) {
+				t.Errorf("got validity %d-%d, want %d-%d", got.ValidAfter, got.ValidBefore, p.ValidAfter.Unix(), p.ValidBefore.Unix())
+			}
+			if !reflect.DeepEqual(got.CriticalOptions, p.CriticalOptions) {
+				t.Errorf("got critical options %q, want %q", got.CriticalOptions, p.CriticalOptions)
+			}
+			if !reflect.DeepEqual(got.Extensions, p.Extensions) {
+				t.Errorf("got extensions %q, want %q", got.Extensions, p.Extensions)
+			}
+			if !bytes.Equal(got.Key.Marshal(), pub.Marshal()) {
+				t.Errorf("certified key does not match")
+			}
+			if got.Signature.Format != test.wantFormat {
+				t.Errorf("got signature format %q, want %q", got.Signature.Format, test.wantFormat)
+			}
+			caPub, err := PublicKey(test.key.Public())
+			if err != nil {
+				t.Fatal(err)
+			}
+			checker := &xssh.CertChecker{
+				SupportedCriticalOptions: []string{"force-command"},
+				IsUserAuthority: func(auth xssh.PublicKey) bool {
+					return bytes.Equal(auth.Marshal(), caPub.Marshal())
+				},
+			}
+			if err := checker.CheckCert("alice", got); err != nil {
+				t.Errorf("certificate rejected: %v", err)
+			}
+			if err := checker.CheckCert("mallory", got); err == nil {
+				t.Errorf("certificate accepted for unlisted principal")
+			}
+		})
+	}
+}
+
+func TestSignCertificateDefaults(t *testing.T) {
+	key, err := ca.GenerateECDSAKey(elliptic.P256())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := PublicKey(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	crt, err := SignCertificate(key, pub, Params{Type: HostCert, Serial: 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if crt.Serial != 42 || crt.ValidAfter != 0 || crt.ValidBefore != xssh.CertTimeInfinity {
+		t.Errorf("got serial %d, validity %d-%d", crt.Serial, crt.ValidAfter, crt.ValidBefore)
+	}
+	checker := &xssh.CertChecker{
+		IsHostAuthority: func(auth xssh.PublicKey, addr string) bool {
+			return bytes.Equal(auth.Marshal(), pub.Marshal())
+		},
+	}
+	if err := checker.CheckHostKey("example.com:22", &net.TCPAddr{}, crt); err != nil {
+		t.Errorf("host certificate rejected: %v", err)
+	}
+
+	if _, err := SignCertificate(key, pub, Params{}); err == nil {
+		t.Errorf("expected error for invalid certificate type")
+	}
+}
@@ -0,0 +1,221 @@
+package ca
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"math/big"
+	"strings"
+	"time"
+
+	errgo "gopkg.in/errgo.v1"
+)
+
+var (
+	// ErrNotFound is the cause of errors returned from a Store
+	// when a requested certificate does not exist.
+	ErrNotFound = errgo.New("certificate not found")
+
+	// ErrDuplicate is the cause of errors returned from a Store
+	// when adding a certificate with a serial number that has
+	// already been used.
+	ErrDuplicate = errgo.New("duplicate serial number")
+
+	// ErrRevoked is the cause of errors returned from a Store when
+	// revoking a certificate that has already been revoked.
+	ErrRevoked = errgo.New("certificate already revoked")
+)
+
+// A Store records the certificates issued by a CA.
+type Store interface {
+	// Add records a newly issued certificate. If a certificate with
+	// the same serial number has already been recorded an error with
+	// a cause of ErrDuplicate is returned.
+	Add(ctx context.Context, crt *x509.Certificate) error
+
+	// Get retrieves the record for the certificate with the given
+	// serial number. If there is no such certificate an error with a
+	// cause of ErrNotFound is returned.
+	Get(ctx context.Context, serial *big.Int) (*Record, error)
+
+	// Find returns the records of all certificates that match the
+	// given query.
+	Find(ctx context.Context, q Query) ([]*Record, error)
+
+	// Revoke marks the certificate with the given serial number as
+	// revoked at the given time for the given reason. If there is no
+	// such certificate an error with a cause of ErrNotFound is
+	// returned. If the certificate has already been revoked the
+	// original revocation is kept and an error with a cause of
+	// ErrRevoked is returned.
+	Revoke(ctx context.Context, serial *big.Int, t time.Time, reason int) error
+}
+
+// A CRLNumberStore is a Store that can also allocate CRL numbers.
+type CRLNumberStore interface {
+	Store
+
+	// NextCRLNumber returns a CRL number for a CRL issued by the
+	// given issuer that is greater than any number it has
+	// previously returned for that issuer and, if min is not nil,
+	// greater than min. Subsequent numbers are also greater than
+	// min.
+	NextCRLNumber(ctx context.Context, issuer *x509.Certificate, min *big.Int) (*big.Int, error)
+}
+
+// A Record holds a certificate and its status.
+type Record struct {
+	Certificate *x509.Certificate
+
+	// Revoked holds whether the certificate has been revoked. If it
+	// has, RevocationTime and RevocationReason hold the details.
+	Revoked          bool
+	RevocationTime   time.Time
+	RevocationReason int
+}
+
+// A Query selects certificates from a Store. Only certificates that
+// match all of the non-zero fields are selected.
+type Query struct {
+	// Subject matches certificates with either the given common
+	// name or the given distinguished name, ignoring case.
+	Subject string
+
+	// SAN matches certificates with a subject alternative name
+	// (DNS name, email address, IP address or URI) equal to the
+	// given value, ignoring case.
+	SAN string
+
+	// ExpiresBefore matches certificates that expire before the
+	// given time.
+	ExpiresBefore time.Time
+
+	// ExpiresAfter matches certificates that expire after the given
+	// time.
+	ExpiresAfter time.Time
+}
+
+// Match reports whether the given certificate matches the query.
+func (q Query) Match(crt *x509.Certificate) bool {
+	if q.Subject != "" && !strings.EqualFold(q.Subject, crt.Subject.CommonName) && !strings.EqualFold(q.Subject, crt.Subject.String()) {
+		return false
+	}
+	if q.SAN != "" && !matchSAN(q.SAN, crt) {
+		return false
+	}
+	if !q.ExpiresBefore.IsZero() && !crt.NotAfter.Before(q.ExpiresBefore) {
+		return false
+	}
+	if !q.ExpiresAfter.IsZero() && !crt.NotAfter.After(q.ExpiresAfter) {
+		return false
+	}
+	return true
+}
+
+func matchSAN(san string, crt *x509.Certificate) bool {
+	for _, n := range crt.DNSNames {
+		if strings.EqualFold(san, n) {
+			return true
+		}
+	}
+	for _, e := range crt.EmailAddresses {
+		if strings.EqualFold(san, e) {
+			return true
+		}
+	}
+	for _, ip := range crt.IPAddresses {
+		if strings.EqualFold(san, ip.String()) {
+			return true
+		}
+	}
+	for _, u := range crt.URIs {
+		if strings.EqualFold(san, u.String()) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewSerialNumber generates a random serial number that has not been
+// used by any certificate in the given store.
+func NewSerialNumber(ctx context.Context, s Store) (*big.Int, error) {
+	for {
+		serial, err := generateSerialNumber()
+		if err != nil {
+			return nil, errgo.Mask(err)
+		}
+		_, err = s.Get(ctx, serial)
+		if errgo.Cause(err) == ErrNotFound {
+			return serial, nil
+		}
+		if err != nil {
+			return nil, errgo.Mask(err)
+		}
+	}
+}
+
+// SignCertificateWithStore is like SignCertificate except that the
+// certificate is recorded in s. If params has no serial number a new
+// one that has not been used in s is generated, otherwise it is an
+// error, with a cause of ErrDuplicate, if the serial number has already
+// been used. If s is nil it is equivalent to SignCertificate.
+func SignCertificateWithStore(ctx context.Context, s Store, csr *x509.CertificateRequest, params, parent *x509.Certificate, key crypto.Signer) (*x509.Certificate, error) {
+	template := RequestTemplate(csr, params)
+	if err := reserveSerialNumber(ctx, s, template); err != nil {
+		return nil, errgo.Mask(err, errgo.Is(ErrDuplicate))
+	}
+	crt, err := createCertificate(template, parent, csr.PublicKey, key)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	return recordCertificate(ctx, s, crt)
+}
+
+// SelfSignCertificateWithStore is like SelfSignCertificate except that
+// the certificate is recorded in s, as for SignCertificateWithStore.
+func SelfSignCertificateWithStore(ctx context.Context, s Store, params *x509.Certificate, key crypto.Signer) (*x509.Certificate, error) {
+	template := *params
+	if err := reserveSerialNumber(ctx, s, &template); err != nil {
+		return nil, errgo.Mask(err, errgo.Is(ErrDuplicate))
+	}
+	crt, err := createCertificate(&template, &template, key.Public(), key)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	return recordCertificate(ctx, s, crt)
+}
+
+// reserveSerialNumber sets a serial number that has not been used in s
+// on template if it does not already have one. If it does, it checks
+// that the serial number has not already been used.
+func reserveSerialNumber(ctx context.Context, s Store, template *x509.Certificate) error {
+	if s == nil {
+		return nil
+	}
+	if template.SerialNumber == nil {
+		serial, err := NewSerialNumber(ctx, s)
+		if err != nil {
+			return errgo.Mask(err)
+		}
+		template.SerialNumber = serial
+		return nil
+	}
+	_, err := s.Get(ctx, template.SerialNumber)
+	if err == nil {
+		return errgo.WithCausef(nil, ErrDuplicate, "serial number %X already used", template.SerialNumber)
+	}
+	if errgo.Cause(err) != ErrNotFound {
+		return errgo.Mask(err)
+	}
+	return nil
+}
+
+func recordCertificate(ctx context.Context, s Store, crt *x509.Certificate) (*x509.Certificate, error) {
+	if s == nil {
+		return crt, nil
+	}
+	if err := s.Add(ctx, crt); err != nil {
+		return nil, errgo.NoteMask(err, "cannot record certificate", errgo.Is(ErrDuplicate))
+	}
+	return crt, nil
+}
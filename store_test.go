@@ -0,0 +1,105 @@
+package ca
+
+import (
+	"context"
+	"crypto/elliptic"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	errgo "gopkg.in/errgo.v1"
+)
+
+func TestSignCertificateWithStore(t *testing.T) {
+	ctx := context.Background()
+	s, err := NewDirStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	caKey, err := GenerateECDSAKey(elliptic.P256())
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent, err := SelfSignCertificateWithStore(ctx, s, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(ctx, parent.SerialNumber); err != nil {
+		t.Errorf("self-signed certificate not recorded: %v", err)
+	}
+
+	key, err := GenerateECDSAKey(elliptic.P256())
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := SignCertificateRequest(&x509.CertificateRequest{
+		DNSNames: []string{"example.com"},
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := &x509.Certificate{
+		NotBefore: time.Now(),
+		NotAfter:  time.Now().Add(time.Hour),
+	}
+	crt, err := SignCertificateWithStore(ctx, s, csr, params, parent, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params.SerialNumber != nil {
+		t.Errorf("params modified")
+	}
+	recs, err := s.Find(ctx, Query{SAN: "example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 1 || recs[0].Certificate.SerialNumber.Cmp(crt.SerialNumber) != 0 {
+		t.Errorf("signed certificate not recorded")
+	}
+
+	params.SerialNumber = new(big.Int).Set(crt.SerialNumber)
+	_, err = SignCertificateWithStore(ctx, s, csr, params, parent, caKey)
+	if errgo.Cause(err) != ErrDuplicate {
+		t.Errorf("got error %v, want cause ErrDuplicate", err)
+	}
+}
+
+func TestDirStoreRevoke(t *testing.T) {
+	ctx := context.Background()
+	s, err := NewDirStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	crt := newTestCertificate(t, "example.com")
+	if err := s.Add(ctx, crt); err != nil {
+		t.Fatal(err)
+	}
+	first := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := s.Revoke(ctx, crt.SerialNumber, first, 1); err != nil {
+		t.Fatal(err)
+	}
+	err = s.Revoke(ctx, crt.SerialNumber, first.Add(time.Hour), 4)
+	if errgo.Cause(err) != ErrRevoked {
+		t.Errorf("got error %v, want cause ErrRevoked", err)
+	}
+	r, err := s.Get(ctx, crt.SerialNumber)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Revoked || !r.RevocationTime.Equal(first) || r.RevocationReason != 1 {
+		t.Errorf("first revocation not kept: got %v, %v, %d", r.Revoked, r.RevocationTime, r.RevocationReason)
+	}
+	err = s.Revoke(ctx, big.NewInt(1), first, 1)
+	if errgo.Cause(err) != ErrNotFound {
+		t.Errorf("got error %v, want cause ErrNotFound", err)
+	}
+}
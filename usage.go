@@ -0,0 +1,122 @@
+package ca
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"strconv"
+	"strings"
+
+	errgo "gopkg.in/errgo.v1"
+)
+
+// keyUsages holds the RFC 5280 names of the key usages. Where a usage
+// has more than one name the preferred name comes first.
+var keyUsages = []struct {
+	name  string
+	usage x509.KeyUsage
+}{
+	{"digitalSignature", x509.KeyUsageDigitalSignature},
+	{"contentCommitment", x509.KeyUsageContentCommitment},
+	{"nonRepudiation", x509.KeyUsageContentCommitment},
+	{"keyEncipherment", x509.KeyUsageKeyEncipherment},
+	{"dataEncipherment", x509.KeyUsageDataEncipherment},
+	{"keyAgreement", x509.KeyUsageKeyAgreement},
+	{"keyCertSign", x509.KeyUsageCertSign},
+	{"cRLSign", x509.KeyUsageCRLSign},
+	{"encipherOnly", x509.KeyUsageEncipherOnly},
+	{"decipherOnly", x509.KeyUsageDecipherOnly},
+}
+
+// ParseKeyUsage parses the RFC 5280 name of a key usage, for example
+// "digitalSignature" or "keyCertSign". Names are not case sensitive.
+func ParseKeyUsage(s string) (x509.KeyUsage, error) {
+	for _, ku := range keyUsages {
+		if strings.EqualFold(ku.name, s) {
+			return ku.usage, nil
+		}
+	}
+	return 0, errgo.Newf("unknown key usage %q", s)
+}
+
+// KeyUsageNames returns the RFC 5280 names of the usages in ku.
+func KeyUsageNames(ku x509.KeyUsage) []string {
+	var names []string
+	for _, u := range keyUsages {
+		if ku&u.usage != 0 {
+			names = append(names, u.name)
+			ku &^= u.usage
+		}
+	}
+	return names
+}
+
+var extKeyUsages = []struct {
+	name  string
+	usage x509.ExtKeyUsage
+	oid   asn1.ObjectIdentifier
+}{
+	{"any", x509.ExtKeyUsageAny, asn1.ObjectIdentifier{2, 5, 29, 37, 0}},
+	{"serverAuth", x509.ExtKeyUsageServerAuth, asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 1}},
+	{"clientAuth", x509.ExtKeyUsageClientAuth, asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 2}},
+	{"codeSigning", x509.ExtKeyUsageCodeSigning, asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 3}},
+	{"emailProtection", x509.ExtKeyUsageEmailProtection, asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 4}},
+	{"ipsecEndSystem", x509.ExtKeyUsageIPSECEndSystem, asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 5}},
+	{"ipsecTunnel", x509.ExtKeyUsageIPSECTunnel, asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 6}},
+	{"ipsecUser", x509.ExtKeyUsageIPSECUser, asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 7}},
+	{"timeStamping", x509.ExtKeyUsageTimeStamping, asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 8}},
+	{"OCSPSigning", x509.ExtKeyUsageOCSPSigning, asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 9}},
+	{"microsoftServerGatedCrypto", x509.ExtKeyUsageMicrosoftServerGatedCrypto, asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 10, 3, 3}},
+	{"netscapeServerGatedCrypto", x509.ExtKeyUsageNetscapeServerGatedCrypto, asn1.ObjectIdentifier{2, 16, 840, 1, 113730, 4, 1}},
+	{"microsoftCommercialCodeSigning", x509.ExtKeyUsageMicrosoftCommercialCodeSigning, asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 1, 22}},
+	{"microsoftKernelCodeSigning", x509.ExtKeyUsageMicrosoftKernelCodeSigning, asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 61, 1, 1}},
+}
+
+// ParseExtKeyUsage parses an extended key usage, which may either be
+// a name, for example "serverAuth" or "clientAuth", or a dotted OID. If
+// the usage is not one known to the x509 package the OID is returned
+// and should be added to the certificate's UnknownExtKeyUsage.
+func ParseExtKeyUsage(s string) (x509.ExtKeyUsage, asn1.ObjectIdentifier, error) {
+	for _, eku := range extKeyUsages {
+		if strings.EqualFold(eku.name, s) {
+			return eku.usage, nil, nil
+		}
+	}
+	oid, err := ParseOID(s)
+	if err != nil {
+		return 0, nil, errgo.Newf("unknown extended key usage %q", s)
+	}
+	for _, eku := range extKeyUsages {
+		if eku.oid.Equal(oid) {
+			return eku.usage, nil, nil
+		}
+	}
+	return 0, oid, nil
+}
+
+// ExtKeyUsageName returns the name of the given extended key usage.
+func ExtKeyUsageName(u x509.ExtKeyUsage) string {
+	for _, eku := range extKeyUsages {
+		if eku.usage == u {
+			return eku.name
+		}
+	}
+	return strconv.Itoa(int(u))
+}
+
+// ParseOID parses an object identifier in dotted decimal form, for
+// example "1.3.6.1.5.5.7.3.1".
+func ParseOID(s string) (asn1.ObjectIdentifier, error) {
+	parts := strings.Split(s, ".")
+	if len(parts) < 2 {
+		return nil, errgo.Newf("invalid OID %q", s)
+	}
+	oid := make(asn1.ObjectIdentifier, len(parts))
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return nil, errgo.Newf("invalid OID %q", s)
+		}
+		oid[i] = n
+	}
+	return oid, nil
+}
@@ -0,0 +1,148 @@
+package ca
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	errgo "gopkg.in/errgo.v1"
+)
+
+// VerifyOptions holds the options for VerifyChain.
+type VerifyOptions struct {
+	// Roots holds the trusted root certificates.
+	Roots []*x509.Certificate
+
+	// Intermediates holds certificates that may be used to build a
+	// chain from the leaf to a root.
+	Intermediates []*x509.Certificate
+
+	// DNSName, if set, is checked against the leaf certificate.
+	DNSName string
+
+	// CurrentTime is the time at which the chain is verified. If it
+	// is zero the current time is used.
+	CurrentTime time.Time
+
+	// KeyUsages holds the extended key usages that the chain must
+	// be valid for. If it is empty any usage is accepted.
+	KeyUsages []x509.ExtKeyUsage
+
+	// CRLs holds CRLs used to check whether certificates in the
+	// chain have been revoked. Each CRL must be signed by the
+	// issuer of the certificates it covers and be current at
+	// CurrentTime.
+	CRLs []*x509.RevocationList
+
+	// RequireCRL specifies that every certificate in the chain other
+	// than the root must be covered by one of the CRLs.
+	RequireCRL bool
+}
+
+// A RevokedError is returned from VerifyChain when a certificate in
+// the chain has been revoked.
+type RevokedError struct {
+	Certificate    *x509.Certificate
+	RevocationTime time.Time
+	Reason         int
+}
+
+// Error implements error.
+func (e *RevokedError) Error() string {
+	return fmt.Sprintf("certificate %q (serial 0x%X) revoked at %s: %s",
+		e.Certificate.Subject,
+		e.Certificate.SerialNumber,
+		e.RevocationTime.UTC().Format(time.RFC3339),
+		RevocationReasonName(e.Reason),
+	)
+}
+
+// VerifyChain verifies that crt chains to one of the given roots and
+// returns the chain, starting with crt and ending with the root. If
+// more than one chain is valid the first one found that passes the
+// revocation checks is returned. If verification fails the error
+// explains why; if a certificate has been revoked its cause is a
+// *RevokedError.
+func VerifyChain(crt *x509.Certificate, opts VerifyOptions) ([]*x509.Certificate, error) {
+	if opts.CurrentTime.IsZero() {
+		opts.CurrentTime = time.Now()
+	}
+	vo := x509.VerifyOptions{
+		DNSName:       opts.DNSName,
+		Roots:         x509.NewCertPool(),
+		Intermediates: x509.NewCertPool(),
+		CurrentTime:   opts.CurrentTime,
+		KeyUsages:     opts.KeyUsages,
+	}
+	if len(vo.KeyUsages) == 0 {
+		vo.KeyUsages = []x509.ExtKeyUsage{x509.ExtKeyUsageAny}
+	}
+	for _, c := range opts.Roots {
+		vo.Roots.AddCert(c)
+	}
+	for _, c := range opts.Intermediates {
+		vo.Intermediates.AddCert(c)
+	}
+	chains, err := crt.Verify(vo)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	var firstErr error
+	for _, chain := range chains {
+		err := checkRevocation(chain, opts)
+		if err == nil {
+			return chain, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return nil, firstErr
+}
+
+// checkRevocation checks the certificates in chain against the CRLs in
+// opts.
+func checkRevocation(chain []*x509.Certificate, opts VerifyOptions) error {
+	for i, crt := range chain[:len(chain)-1] {
+		issuer := chain[i+1]
+		crl, err := findCRL(issuer, opts)
+		if err != nil {
+			return err
+		}
+		if crl == nil {
+			if opts.RequireCRL {
+				return errgo.Newf("no CRL available for issuer %q", issuer.Subject)
+			}
+			continue
+		}
+		for _, e := range crl.RevokedCertificateEntries {
+			if e.SerialNumber.Cmp(crt.SerialNumber) == 0 {
+				return &RevokedError{
+					Certificate:    crt,
+					RevocationTime: e.RevocationTime,
+					Reason:         e.ReasonCode,
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// findCRL finds the CRL issued by issuer in opts.CRLs. It returns nil
+// if there is none.
+func findCRL(issuer *x509.Certificate, opts VerifyOptions) (*x509.RevocationList, error) {
+	for _, crl := range opts.CRLs {
+		if !bytes.Equal(crl.RawIssuer, issuer.RawSubject) {
+			continue
+		}
+		if err := crl.CheckSignatureFrom(issuer); err != nil {
+			return nil, errgo.Notef(err, "invalid CRL for issuer %q", issuer.Subject)
+		}
+		if !crl.NextUpdate.IsZero() && opts.CurrentTime.After(crl.NextUpdate) {
+			return nil, errgo.Newf("CRL for issuer %q expired at %s", issuer.Subject, crl.NextUpdate.UTC().Format(time.RFC3339))
+		}
+		return crl, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,151 @@
+package ca
+
+import (
+	"context"
+	"crypto/elliptic"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	errgo "gopkg.in/errgo.v1"
+)
+
+func TestVerifyChain(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	root := newTestIssuer(t)
+	intKey, err := GenerateECDSAKey(elliptic.P256())
+	if err != nil {
+		t.Fatal(err)
+	}
+	intCrt, err := root.IssueFor(ctx, intKey.Public(), &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "test intermediate"},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	intermediate, err := NewIssuer(intCrt, intKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafKey, err := GenerateECDSAKey(elliptic.P256())
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := intermediate.IssueFor(ctx, leafKey.Public(), &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "example.com"},
+		DNSNames:    []string{"example.com"},
+		NotBefore:   now.Add(-time.Minute),
+		NotAfter:    now.Add(time.Hour),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	createCRL := func(iss *Issuer, nextUpdate time.Time, revoked ...*x509.Certificate) *x509.RevocationList {
+		var entries []x509.RevocationListEntry
+		for _, crt := range revoked {
+			entries = append(entries, x509.RevocationListEntry{
+				SerialNumber:   crt.SerialNumber,
+				RevocationTime: now.Add(-time.Minute),
+				ReasonCode:     1,
+			})
+		}
+		crl, err := iss.CreateCRL(ctx, &x509.RevocationList{
+			Number:                    big.NewInt(1),
+			ThisUpdate:                nextUpdate.Add(-time.Hour),
+			NextUpdate:                nextUpdate,
+			RevokedCertificateEntries: entries,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return crl
+	}
+	rootCRL := createCRL(root, now.Add(time.Hour))
+	intCRL := createCRL(intermediate, now.Add(time.Hour))
+	revokedCRL := createCRL(intermediate, now.Add(time.Hour), leaf)
+	expiredCRL := createCRL(intermediate, now.Add(-time.Minute))
+
+	tests := []struct {
+		about       string
+		opts        VerifyOptions
+		wantErr     string
+		wantRevoked bool
+	}{{
+		about: "good chain",
+	}, {
+		about: "hostname",
+		opts:  VerifyOptions{DNSName: "example.com", KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}},
+	}, {
+		about:   "untrusted root",
+		opts:    VerifyOptions{Roots: []*x509.Certificate{newTestIssuer(t).Certificate()}},
+		wantErr: "certificate signed by unknown authority",
+	}, {
+		about:   "wrong extended key usage",
+		opts:    VerifyOptions{KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}},
+		wantErr: "incompatible key usage",
+	}, {
+		about:   "hostname mismatch",
+		opts:    VerifyOptions{DNSName: "example.org"},
+		wantErr: "not example.org",
+	}, {
+		about: "CRLs",
+		opts:  VerifyOptions{CRLs: []*x509.RevocationList{rootCRL, intCRL}, RequireCRL: true},
+	}, {
+		about:       "revoked leaf",
+		opts:        VerifyOptions{CRLs: []*x509.RevocationList{revokedCRL}},
+		wantErr:     "revoked",
+		wantRevoked: true,
+	}, {
+		about:   "expired CRL",
+		opts:    VerifyOptions{CRLs: []*x509.RevocationList{expiredCRL}},
+		wantErr: "expired",
+	}, {
+		about:   "CRL required",
+		opts:    VerifyOptions{RequireCRL: true},
+		wantErr: `no CRL available for issuer "CN=test intermediate"`,
+	}, {
+		about:   "CRL required for intermediate",
+		opts:    VerifyOptions{CRLs: []*x509.RevocationList{intCRL}, RequireCRL: true},
+		wantErr: `no CRL available for issuer "CN=test CA"`,
+	}}
+	for _, test := range tests {
+		t.Run(test.about, func(t *testing.T) {
+			opts := test.opts
+			if opts.Roots == nil {
+				opts.Roots = []*x509.Certificate{root.Certificate()}
+			}
+			opts.Intermediates = []*x509.Certificate{intCrt}
+			chain, err := VerifyChain(leaf, opts)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("got error %v, want error containing %q", err, test.wantErr)
+				}
+				rerr, ok := errgo.Cause(err).(*RevokedError)
+				if ok != test.wantRevoked {
+					t.Fatalf("got error cause %T", errgo.Cause(err))
+				}
+				if ok && (rerr.Certificate != leaf || rerr.Reason != 1) {
+					t.Errorf("unexpected revocation details %#v", rerr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(chain) != 3 || chain[0] != leaf || chain[1] != intCrt || !chain[2].Equal(root.Certificate()) {
+				t.Errorf("unexpected chain %v", chain)
+			}
+		})
+	}
+}